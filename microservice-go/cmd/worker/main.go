@@ -8,11 +8,11 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 
 	"educasa/internal/api"
 	"educasa/internal/config"
 	"educasa/internal/database"
+	"educasa/internal/models"
 	"educasa/internal/worker"
 
 	_ "github.com/joho/godotenv/autoload"
@@ -85,27 +85,32 @@ func main() {
 		}
 	}
 
-	// Criar cliente de email
-	emailClient := worker.NewSMTPClient(
-		cfg.SMTPHost,
-		cfg.SMTPPort,
-		cfg.SMTPUsername,
-		cfg.SMTPPassword,
-		cfg.SMTPFromEmail,
-		cfg.SMTPFromName,
-	)
+	// Criar backend de email (MAIL_BACKEND)
+	mailer, err := worker.NewMailer(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create mailer: %v", err)
+	}
+	log.Printf("Mail backend: %s", cfg.MailBackend)
 
 	// Criar job processor
-	jobProcessor := worker.NewJobProcessor(db, emailClient, cfg)
+	jobProcessor := worker.NewJobProcessor(db, mailer, cfg)
+	for jobType, policy := range cfg.RetryPolicies {
+		jobProcessor.SetRetryPolicy(jobType, worker.RetryPolicy{
+			BaseDelay:  policy.BaseDelay,
+			MaxDelay:   policy.MaxDelay,
+			Multiplier: 2,
+			Jitter:     0.2,
+		})
+	}
 
 	// Criar scheduler
 	scheduler := worker.NewScheduler(cfg, db)
 
 	// Configurar função de enfileiramento para o scheduler
-	scheduler.SetEnqueueJobFunc(func(ctx context.Context, payload map[string]interface{}) (string, error) {
-		// Sync antes de enfileirar job mensal
+	scheduler.SetEnqueueJobFunc(func(ctx context.Context, req models.EnqueueRequest) (string, error) {
+		// Sync antes de enfileirar job agendado
 		if syncManager != nil {
-			log.Println("Syncing before monthly job...")
+			log.Println("Syncing before scheduled job...")
 			if result, err := syncManager.SyncWithResult(); err != nil {
 				log.Printf("Warning: sync failed before job: %v", err)
 			} else {
@@ -113,11 +118,7 @@ func main() {
 			}
 		}
 
-		jobType := "MANUAL"
-		if t, ok := payload["type"].(string); ok {
-			jobType = t
-		}
-		return api.EnqueueJob(db, jobType, 1, payload)
+		return api.EnqueueJob(ctx, db, req)
 	})
 
 	// Iniciar scheduler
@@ -133,7 +134,7 @@ func main() {
 	go jobProcessor.Start(ctx)
 
 	// Configurar servidor HTTP
-	router := api.NewRouter(db, jobProcessor, syncManager, cfg.GOWorkerAPIKey)
+	router := api.NewRouter(db, jobProcessor, scheduler, syncManager, cfg)
 
 	server := &http.Server{
 		Addr:    fmt.Sprintf("%s:%s", cfg.ServerHost, cfg.ServerPort),
@@ -141,24 +142,33 @@ func main() {
 	}
 
 	// Graceful shutdown
+	shutdownDone := make(chan struct{})
 	go func() {
+		defer close(shutdownDone)
+
 		sigChan := make(chan os.Signal, 1)
 		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 		<-sigChan
 
 		log.Println("Shutting down...")
+		// Parar de buscar novos jobs
 		cancel()
 
 		if syncManager != nil {
 			syncManager.Stop()
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
 		defer cancel()
 
 		if err := server.Shutdown(ctx); err != nil {
 			log.Printf("Server shutdown error: %v", err)
 		}
+
+		// Aguardar jobs em andamento
+		if err := jobProcessor.Shutdown(ctx); err != nil {
+			log.Printf("Job processor shutdown: %v (in-flight jobs returned to queue)", err)
+		}
 	}()
 
 	log.Printf("Server started on %s", server.Addr)
@@ -171,5 +181,6 @@ func main() {
 		log.Fatalf("Server failed: %v", err)
 	}
 
+	<-shutdownDone
 	log.Println("Server stopped")
 }
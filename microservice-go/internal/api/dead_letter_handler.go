@@ -0,0 +1,131 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"educasa/internal/database"
+
+	"github.com/gorilla/mux"
+)
+
+// DeadLetterHandler lista jobs que falharam permanentemente (retry_count >= max_retries)
+func (h *Handlers) DeadLetterHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit := 50
+	if l := r.URL.Query().Get("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed < 1 || parsed > 500 {
+			http.Error(w, "Invalid limit (1-500)", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	ctx := r.Context()
+
+	jobs, err := database.GetDeadLetterJobs(ctx, h.db, r.URL.Query().Get("type"), limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	total, err := database.CountDeadLetterJobs(ctx, h.db)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"total": total,
+		"jobs":  jobs,
+	})
+}
+
+// DeadLetterRequeueHandler devolve jobs da dead-letter à fila com tentativas zeradas
+func (h *Handlers) DeadLetterRequeueHandler(w http.ResponseWriter, r *http.Request) {
+	h.updateDeadLetter(w, r, "requeued", database.RequeueDeadLetterJobs)
+}
+
+// DeadLetterDiscardHandler descarta jobs da dead-letter (status DISCARDED)
+func (h *Handlers) DeadLetterDiscardHandler(w http.ResponseWriter, r *http.Request) {
+	h.updateDeadLetter(w, r, "discarded", database.DiscardDeadLetterJobs)
+}
+
+// updateDeadLetter aplica uma ação aos jobs informados.
+// Em /jobs/{id}/... o job vem da URL; nas rotas em lote, do corpo {"job_ids": [...]}.
+func (h *Handlers) updateDeadLetter(
+	w http.ResponseWriter,
+	r *http.Request,
+	action string,
+	apply func(ctx context.Context, db *sql.DB, jobIDs []string) ([]string, error),
+) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := r.Context()
+
+	jobID := mux.Vars(r)["id"]
+	jobIDs := []string{jobID}
+
+	if jobID == "" {
+		var req struct {
+			JobIDs []string `json:"job_ids"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(req.JobIDs) == 0 {
+			http.Error(w, "job_ids is required", http.StatusBadRequest)
+			return
+		}
+		jobIDs = req.JobIDs
+	} else if _, err := database.GetJob(ctx, h.db, jobID); errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	updated, err := apply(ctx, h.db, jobIDs)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if jobID != "" && len(updated) == 0 {
+		http.Error(w, "Job is not in the dead-letter queue", http.StatusConflict)
+		return
+	}
+
+	// IDs ignorados: inexistentes ou fora da dead-letter
+	skipped := []string{}
+	done := make(map[string]bool, len(updated))
+	for _, id := range updated {
+		done[id] = true
+	}
+	for _, id := range jobIDs {
+		if !done[id] {
+			skipped = append(skipped, id)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		action:    updated,
+		"skipped": skipped,
+	})
+}
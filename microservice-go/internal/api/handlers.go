@@ -4,20 +4,33 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"educasa/internal/database"
+	"educasa/internal/models"
 	"educasa/internal/worker"
+
+	"github.com/gorilla/mux"
 )
 
 // Handlers contém os handlers HTTP
 type Handlers struct {
-	db              *sql.DB
-	jobProcessor    *worker.JobProcessor
-	enqueueJobFunc  func(context.Context, map[string]interface{}) (string, error)
-	syncManager     *database.SyncManager
+	db             *sql.DB
+	jobProcessor   *worker.JobProcessor
+	enqueueJobFunc func(context.Context, models.EnqueueRequest) (string, error)
+	syncManager    *database.SyncManager
+	scheduler      *worker.Scheduler
+
+	// Janela de deduplicação por Idempotency-Key
+	idempotencyWindow time.Duration
+
+	// Retenção de jobs finalizados, em dias (0 = desativada)
+	retentionDays int
 }
 
 // NewHandlers cria novos handlers
@@ -33,8 +46,23 @@ func (h *Handlers) SetSyncManager(sm *database.SyncManager) {
 	h.syncManager = sm
 }
 
+// SetScheduler define o scheduler recarregado quando agendamentos mudam
+func (h *Handlers) SetScheduler(s *worker.Scheduler) {
+	h.scheduler = s
+}
+
+// SetIdempotencyWindow define por quanto tempo uma Idempotency-Key deduplica enqueues
+func (h *Handlers) SetIdempotencyWindow(window time.Duration) {
+	h.idempotencyWindow = window
+}
+
+// SetRetentionDays define a retenção usada no relatório de limpeza
+func (h *Handlers) SetRetentionDays(days int) {
+	h.retentionDays = days
+}
+
 // SetEnqueueJobFunc define a função para enfileirar jobs
-func (h *Handlers) SetEnqueueJobFunc(fn func(context.Context, map[string]interface{}) (string, error)) {
+func (h *Handlers) SetEnqueueJobFunc(fn func(context.Context, models.EnqueueRequest) (string, error)) {
 	h.enqueueJobFunc = fn
 }
 
@@ -46,34 +74,139 @@ func (h *Handlers) EnqueueJobHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		Type     string                 `json:"type"`
-		Priority int                    `json:"priority,omitempty"`
-		Payload  map[string]interface{} `json:"payload"`
+		Type       string                 `json:"type"`
+		Priority   int                    `json:"priority,omitempty"`
+		MaxRetries *int                   `json:"max_retries,omitempty"`
+		RunAt      string                 `json:"run_at,omitempty"`
+		Payload    map[string]interface{} `json:"payload"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeValidationError(w, models.FieldError{Field: "body", Message: err.Error()})
 		return
 	}
 
-	// Validar tipo
-	if req.Type != "MANUAL" && req.Type != "MONTHLY_AUTO" {
-		http.Error(w, "Invalid job type", http.StatusBadRequest)
+	// Validar tipo, limites e payload
+	var fieldErrors []models.FieldError
+
+	if req.Type != models.JobTypeManual && req.Type != models.JobTypeMonthlyAuto {
+		fieldErrors = append(fieldErrors, models.FieldError{Field: "type", Message: "must be MANUAL or MONTHLY_AUTO"})
+	}
+
+	maxRetries := models.DefaultMaxRetries
+	if req.MaxRetries != nil {
+		maxRetries = *req.MaxRetries
+		if maxRetries < 0 || maxRetries > maxEnqueueRetries {
+			fieldErrors = append(fieldErrors, models.FieldError{Field: "max_retries", Message: fmt.Sprintf("must be between 0 and %d", maxEnqueueRetries)})
+		}
+	}
+
+	// Horário agendado (opcional); no passado o job roda imediatamente
+	var runAt *time.Time
+	if req.RunAt != "" {
+		t, err := time.Parse(time.RFC3339, req.RunAt)
+		if err != nil {
+			fieldErrors = append(fieldErrors, models.FieldError{Field: "run_at", Message: "must be an RFC 3339 date (e.g. 2026-12-20T08:00:00-03:00)"})
+		} else {
+			runAt = &t
+		}
+	}
+
+	if req.Payload == nil {
+		fieldErrors = append(fieldErrors, models.FieldError{Field: "payload", Message: "is required"})
+	} else {
+		_, payloadErrors := models.ParseExportJobPayload(req.Payload)
+		for _, fe := range payloadErrors {
+			fe.Field = "payload." + fe.Field
+			fieldErrors = append(fieldErrors, fe)
+		}
+	}
+
+	// Chave de idempotência: header tem precedência sobre o campo do payload
+	key := r.Header.Get("Idempotency-Key")
+	if key == "" {
+		key, _ = req.Payload["idempotency_key"].(string)
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		fieldErrors = append(fieldErrors, models.FieldError{Field: "idempotency_key", Message: fmt.Sprintf("must be at most %d characters", maxIdempotencyKeyLength)})
+	}
+
+	if len(fieldErrors) > 0 {
+		writeValidationError(w, fieldErrors...)
 		return
 	}
 
-	// Enfileirar job
 	ctx := r.Context()
-	jobID, err := h.enqueueJobFunc(ctx, req.Payload)
+
+	// Repetição dentro da janela: devolver o job original
+	if key != "" {
+		if job, err := h.findIdempotentJob(ctx, key); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		} else if job != nil {
+			writeEnqueueResponse(w, job.ID, job.Status, true)
+			return
+		}
+	}
+
+	// Enfileirar job
+	jobID, err := h.enqueueJobFunc(ctx, models.EnqueueRequest{
+		Type:           req.Type,
+		Priority:       req.Priority,
+		MaxRetries:     maxRetries,
+		Payload:        req.Payload,
+		IdempotencyKey: key,
+		RunAt:          runAt,
+	})
+	if errors.Is(err, models.ErrDuplicateIdempotencyKey) {
+		// Outra requisição com a mesma chave venceu a corrida
+		job, err := database.GetJobByIdempotencyKey(ctx, h.db, key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeEnqueueResponse(w, job.ID, job.Status, true)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	writeEnqueueResponse(w, jobID, "PENDING", false)
+}
+
+// writeValidationError responde 400 com a lista de campos inválidos
+func writeValidationError(w http.ResponseWriter, details ...models.FieldError) {
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"job_id": jobID,
-		"status": "PENDING",
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":   "validation failed",
+		"details": details,
+	})
+}
+
+// findIdempotentJob busca o job criado com a chave dentro da janela de idempotência.
+// Chaves mais antigas que a janela são liberadas; retorna nil se não houver job.
+func (h *Handlers) findIdempotentJob(ctx context.Context, key string) (*models.Job, error) {
+	if err := database.ExpireIdempotencyKey(ctx, h.db, key, time.Now().Add(-h.idempotencyWindow)); err != nil {
+		return nil, err
+	}
+
+	job, err := database.GetJobByIdempotencyKey(ctx, h.db, key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return job, err
+}
+
+// writeEnqueueResponse responde ao enqueue com o job criado ou o original (duplicate)
+func writeEnqueueResponse(w http.ResponseWriter, jobID, status string, duplicate bool) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"job_id":    jobID,
+		"status":    status,
+		"duplicate": duplicate,
 	})
 }
 
@@ -84,14 +217,119 @@ func (h *Handlers) JobStatusHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Extrair job ID da URL
-	// TODO: Implementar parsing correto da URL
+	jobID := mux.Vars(r)["id"]
+	if jobID == "" {
+		http.Error(w, "Missing job ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+
+	job, err := database.GetJob(ctx, h.db, jobID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	batches, err := database.GetJobBatches(ctx, h.db, jobID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Progresso a partir dos batches registrados
+	totalBatches, sentBatches := 0, 0
+	for _, b := range batches {
+		totalBatches = b.TotalBatches
+		if b.EmailSent {
+			sentBatches++
+		}
+	}
+
+	// Duração do processamento
+	var durationMs *int64
+	if job.StartedAt != nil {
+		end := time.Now()
+		if job.CompletedAt != nil {
+			end = *job.CompletedAt
+		}
+		d := end.Sub(*job.StartedAt).Milliseconds()
+		durationMs = &d
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"message": "Job status handler - TODO",
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"job":     job,
+		"batches": batches,
+		"progress": map[string]interface{}{
+			"total_batches": totalBatches,
+			"sent_batches":  sentBatches,
+		},
+		"duration_ms": durationMs,
 	})
 }
 
+// CancelJobHandler cancela um job.
+// Jobs pendentes são cancelados na hora; jobs em PROCESSING param após o batch atual.
+func (h *Handlers) CancelJobHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	jobID := mux.Vars(r)["id"]
+	ctx := r.Context()
+
+	cancelled, err := database.CancelPendingJob(ctx, h.db, jobID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if cancelled {
+		h.jobProcessor.SyncCancelledJob(ctx, jobID)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"job_id": jobID,
+			"status": "CANCELLED",
+		})
+		return
+	}
+
+	requested, err := database.RequestJobCancel(ctx, h.db, jobID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if requested {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"job_id":  jobID,
+			"status":  "PROCESSING",
+			"message": "Cancellation requested, job will stop after the current batch",
+		})
+		return
+	}
+
+	// Nem pendente nem em processamento: inexistente ou já finalizado
+	job, err := database.GetJob(ctx, h.db, jobID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Error(w, "Job already finished with status "+job.Status, http.StatusConflict)
+}
+
 // QueueHandler lista jobs na fila
 func (h *Handlers) QueueHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -123,9 +361,54 @@ func (h *Handlers) QueueHandler(w http.ResponseWriter, r *http.Request) {
 		summary[status] = count
 	}
 
+	// Pendentes que só rodam no futuro (run_at)
+	scheduled, err := database.CountScheduledJobs(r.Context(), h.db)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"summary": summary,
+		"summary":   summary,
+		"scheduled": scheduled,
+	})
+}
+
+// RetentionReportHandler retorna o que a limpeza de jobs antigos removeria (dry-run).
+// older_than_days sobrescreve JOB_RETENTION_DAYS para simular outras políticas.
+func (h *Handlers) RetentionReportHandler(w http.ResponseWriter, r *http.Request) {
+	days := h.retentionDays
+	if d := r.URL.Query().Get("older_than_days"); d != "" {
+		parsed, err := strconv.Atoi(d)
+		if err != nil || parsed < 1 {
+			writeValidationError(w, models.FieldError{Field: "older_than_days", Message: "must be a positive integer"})
+			return
+		}
+		days = parsed
+	}
+
+	if days == 0 {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"enabled": false,
+			"message": "Retention disabled (JOB_RETENTION_DAYS=0); pass older_than_days to simulate",
+		})
+		return
+	}
+
+	report, err := database.GetPurgeReport(r.Context(), h.db, worker.RetentionCutoff(days, time.Now()))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"enabled":         h.retentionDays > 0,
+		"dry_run":         true,
+		"older_than_days": days,
+		"report":          report,
 	})
 }
 
@@ -147,27 +430,50 @@ func (h *Handlers) HealthHandler(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":        "healthy",
-		"database":      "connected",
-		"queue_size":    queueSize,
-		"worker_status": "running",
-		"timestamp":     time.Now().Format(time.RFC3339),
+		"status":         "healthy",
+		"database":       "connected",
+		"queue_size":     queueSize,
+		"worker_status":  "running",
+		"jobs_in_flight": h.jobProcessor.InFlight(),
+		"max_concurrent": h.jobProcessor.Capacity(),
+		"mail_quota":     h.jobProcessor.MailQuota(r.Context()),
+		"timestamp":      time.Now().Format(time.RFC3339),
 	})
 }
 
-// EnqueueJob enfileira um job no banco de dados
-func EnqueueJob(db *sql.DB, jobType string, priority int, payload map[string]interface{}) (string, error) {
+// Limites aceitos em /jobs/enqueue
+const (
+	maxIdempotencyKeyLength = 255
+	maxEnqueueRetries       = 10
+)
+
+// EnqueueJob enfileira um job no banco de dados.
+// IdempotencyKey, se informada, é gravada na coluna única.
+func EnqueueJob(ctx context.Context, db *sql.DB, req models.EnqueueRequest) (string, error) {
 	jobID := fmt.Sprintf("job_%d", time.Now().UnixNano())
 
-	payloadBytes, _ := json.Marshal(payload)
+	payloadBytes, err := json.Marshal(req.Payload)
+	if err != nil {
+		return "", err
+	}
+
+	idempotencyKey := sql.NullString{String: req.IdempotencyKey, Valid: req.IdempotencyKey != ""}
+
+	var runAt sql.NullString
+	if req.RunAt != nil {
+		runAt = sql.NullString{String: database.FormatTime(*req.RunAt), Valid: true}
+	}
 
 	query := `
-		INSERT INTO export_jobs (id, type, status, priority, payload)
-		VALUES (?, ?, 'PENDING', ?, ?)
+		INSERT INTO export_jobs (id, type, status, priority, payload, max_retries, idempotency_key, run_at)
+		VALUES (?, ?, 'PENDING', ?, ?, ?, ?, ?)
 	`
 
-	_, err := db.Exec(query, jobID, jobType, priority, string(payloadBytes))
+	_, err = db.ExecContext(ctx, query, jobID, req.Type, req.Priority, string(payloadBytes), req.MaxRetries, idempotencyKey, runAt)
 	if err != nil {
+		if req.IdempotencyKey != "" && strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return "", fmt.Errorf("%w: %s", models.ErrDuplicateIdempotencyKey, req.IdempotencyKey)
+		}
 		return "", err
 	}
 
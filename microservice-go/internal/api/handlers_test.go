@@ -0,0 +1,158 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"educasa/internal/database"
+	"educasa/internal/models"
+)
+
+// openJobsDB abre um banco local vazio com o schema do worker
+func openJobsDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("libsql", "file:"+filepath.Join(t.TempDir(), "jobs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := database.InitSchema(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestEnqueueJobDuplicateIdempotencyKey(t *testing.T) {
+	ctx := context.Background()
+	db := openJobsDB(t)
+
+	req := models.EnqueueRequest{
+		Type:           models.JobTypeManual,
+		MaxRetries:     models.DefaultMaxRetries,
+		Payload:        map[string]interface{}{"user_ids": []string{"u1"}},
+		IdempotencyKey: "export-u1-2025-01",
+	}
+
+	firstID, err := EnqueueJob(ctx, db, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := EnqueueJob(ctx, db, req); !errors.Is(err, models.ErrDuplicateIdempotencyKey) {
+		t.Fatalf("erro = %v, esperado ErrDuplicateIdempotencyKey", err)
+	}
+
+	job, err := database.GetJobByIdempotencyKey(ctx, db, req.IdempotencyKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.ID != firstID {
+		t.Errorf("job da chave = %s, esperado %s", job.ID, firstID)
+	}
+
+	// Sem chave não há deduplicação
+	req.IdempotencyKey = ""
+	for i := 0; i < 2; i++ {
+		if _, err := EnqueueJob(ctx, db, req); err != nil {
+			t.Fatalf("enqueue sem chave %d: %v", i+1, err)
+		}
+	}
+}
+
+func TestEnqueueJobHandlerIdempotency(t *testing.T) {
+	tests := []struct {
+		name          string
+		header        string
+		payloadKey    string
+		firstAge      time.Duration // Idade do primeiro job quando a repetição chega
+		wantDuplicate bool
+	}{
+		{"header repetido na janela", "chave-1", "", 0, true},
+		{"campo do payload repetido na janela", "", "chave-1", 0, true},
+		{"header repetido após a janela", "chave-1", "", 2 * time.Hour, false},
+		{"sem chave", "", "", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openJobsDB(t)
+			h := NewHandlers(db, nil)
+			h.SetIdempotencyWindow(time.Hour)
+			h.SetEnqueueJobFunc(func(ctx context.Context, req models.EnqueueRequest) (string, error) {
+				return EnqueueJob(ctx, db, req)
+			})
+
+			payload := map[string]interface{}{
+				"start_date": "2025-01-01T00:00:00Z",
+				"end_date":   "2025-01-31T23:59:59Z",
+				"user_ids":   []string{"u1"},
+				"to_email":   "secretaria@escola.com",
+			}
+			if tt.payloadKey != "" {
+				payload["idempotency_key"] = tt.payloadKey
+			}
+			body, _ := json.Marshal(map[string]interface{}{"type": models.JobTypeManual, "payload": payload})
+
+			enqueue := func() (resp struct {
+				JobID     string `json:"job_id"`
+				Duplicate bool   `json:"duplicate"`
+			}) {
+				t.Helper()
+				r := httptest.NewRequest(http.MethodPost, "/jobs/enqueue", strings.NewReader(string(body)))
+				if tt.header != "" {
+					r.Header.Set("Idempotency-Key", tt.header)
+				}
+				w := httptest.NewRecorder()
+				h.EnqueueJobHandler(w, r)
+				if w.Code != http.StatusOK {
+					t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+				}
+				if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+					t.Fatal(err)
+				}
+				return resp
+			}
+
+			first := enqueue()
+			if first.Duplicate {
+				t.Fatal("primeiro enqueue marcado como duplicate")
+			}
+			if tt.firstAge > 0 {
+				createdAt := database.FormatTime(time.Now().Add(-tt.firstAge))
+				if _, err := db.Exec(`UPDATE export_jobs SET created_at = ? WHERE id = ?`, createdAt, first.JobID); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// IDs usam o relógio em nanossegundos
+			time.Sleep(time.Millisecond)
+
+			second := enqueue()
+			if second.Duplicate != tt.wantDuplicate || (second.JobID == first.JobID) != tt.wantDuplicate {
+				t.Errorf("repetição = %s (duplicate %v), primeiro = %s; esperado duplicate %v",
+					second.JobID, second.Duplicate, first.JobID, tt.wantDuplicate)
+			}
+
+			var count int
+			if err := db.QueryRow(`SELECT COUNT(*) FROM export_jobs`).Scan(&count); err != nil {
+				t.Fatal(err)
+			}
+			wantCount := 2
+			if tt.wantDuplicate {
+				wantCount = 1
+			}
+			if count != wantCount {
+				t.Errorf("%d jobs gravados, esperado %d", count, wantCount)
+			}
+		})
+	}
+}
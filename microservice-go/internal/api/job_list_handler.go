@@ -0,0 +1,159 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"educasa/internal/database"
+	"educasa/internal/models"
+)
+
+// jobStatuses lista os status aceitos no filtro de ListJobsHandler
+var jobStatuses = map[string]bool{
+	"PENDING":    true,
+	"PROCESSING": true,
+	"COMPLETED":  true,
+	"FAILED":     true,
+	"CANCELLED":  true,
+	"DISCARDED":  true,
+}
+
+// Tamanho de página de ListJobsHandler
+const (
+	defaultJobPageSize = 50
+	maxJobPageSize     = 200
+)
+
+// ListJobsHandler lista jobs com filtros e paginação por cursor.
+//
+// Parâmetros: status (separados por vírgula), type, created_from, created_to (RFC 3339),
+// user_id, sort (created_at|priority), order (desc|asc), limit e cursor.
+func (h *Handlers) ListJobsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := database.JobFilter{
+		Type:   q.Get("type"),
+		UserID: q.Get("user_id"),
+		Sort:   database.JobSortCreatedAt,
+		Limit:  defaultJobPageSize,
+	}
+
+	var fieldErrors []models.FieldError
+
+	if statuses := q.Get("status"); statuses != "" {
+		for _, st := range strings.Split(statuses, ",") {
+			st = strings.ToUpper(strings.TrimSpace(st))
+			if !jobStatuses[st] {
+				fieldErrors = append(fieldErrors, models.FieldError{Field: "status", Message: fmt.Sprintf("unknown status %q", st)})
+				continue
+			}
+			filter.Statuses = append(filter.Statuses, st)
+		}
+	}
+
+	for _, param := range []struct {
+		name string
+		dst  **time.Time
+	}{
+		{"created_from", &filter.CreatedFrom},
+		{"created_to", &filter.CreatedTo},
+	} {
+		if v := q.Get(param.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				fieldErrors = append(fieldErrors, models.FieldError{Field: param.name, Message: "must be an RFC 3339 date"})
+				continue
+			}
+			*param.dst = &t
+		}
+	}
+
+	switch sort := q.Get("sort"); sort {
+	case "", database.JobSortCreatedAt:
+	case database.JobSortPriority:
+		filter.Sort = sort
+	default:
+		fieldErrors = append(fieldErrors, models.FieldError{Field: "sort", Message: "must be created_at or priority"})
+	}
+
+	switch order := q.Get("order"); order {
+	case "", "desc":
+	case "asc":
+		filter.Ascending = true
+	default:
+		fieldErrors = append(fieldErrors, models.FieldError{Field: "order", Message: "must be asc or desc"})
+	}
+
+	if l := q.Get("limit"); l != "" {
+		limit, err := strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > maxJobPageSize {
+			fieldErrors = append(fieldErrors, models.FieldError{Field: "limit", Message: fmt.Sprintf("must be between 1 and %d", maxJobPageSize)})
+		} else {
+			filter.Limit = limit
+		}
+	}
+
+	if c := q.Get("cursor"); c != "" {
+		cursor, err := decodeJobCursor(c)
+		if err != nil {
+			fieldErrors = append(fieldErrors, models.FieldError{Field: "cursor", Message: "is invalid"})
+		} else {
+			filter.After = cursor
+		}
+	}
+
+	if len(fieldErrors) > 0 {
+		writeValidationError(w, fieldErrors...)
+		return
+	}
+
+	// Um job a mais indica que existe próxima página
+	pageSize := filter.Limit
+	filter.Limit++
+
+	jobs, err := database.ListJobs(r.Context(), h.db, filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var nextCursor *string
+	if len(jobs) > pageSize {
+		jobs = jobs[:pageSize]
+		c := encodeJobCursor(database.CursorFor(jobs[len(jobs)-1]))
+		nextCursor = &c
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"jobs":        jobs,
+		"next_cursor": nextCursor,
+	})
+}
+
+// encodeJobCursor serializa o cursor como token opaco para a URL
+func encodeJobCursor(c database.JobCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeJobCursor lê um token gerado por encodeJobCursor
+func decodeJobCursor(token string) (*database.JobCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, err
+	}
+
+	var c database.JobCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	if c.ID == "" || c.CreatedAt == "" {
+		return nil, fmt.Errorf("incomplete cursor")
+	}
+	return &c, nil
+}
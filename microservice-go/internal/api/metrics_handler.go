@@ -0,0 +1,57 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"educasa/internal/database"
+)
+
+// MetricsHandler retorna contadores da fila, da réplica e da cota de envio
+func (h *Handlers) MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.db.QueryContext(r.Context(), `SELECT status, COUNT(*) FROM export_jobs GROUP BY status`)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	jobs := make(map[string]int)
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		jobs[status] = count
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	scheduled, err := database.CountScheduledJobs(r.Context(), h.db)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	deadLetter, err := database.CountDeadLetterJobs(r.Context(), h.db)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"jobs":           jobs,
+		"scheduled":      scheduled,
+		"dead_letter":    deadLetter,
+		"jobs_in_flight": h.jobProcessor.InFlight(),
+		"max_concurrent": h.jobProcessor.Capacity(),
+		"mail_quota":     h.jobProcessor.MailQuota(r.Context()),
+		"timestamp":      time.Now().Format(time.RFC3339),
+	})
+}
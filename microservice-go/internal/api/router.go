@@ -4,44 +4,58 @@ import (
 	"context"
 	"database/sql"
 
+	"educasa/internal/config"
 	"educasa/internal/database"
+	"educasa/internal/models"
 	"educasa/internal/worker"
 
 	"github.com/gorilla/mux"
 )
 
 // NewRouter cria um novo router com todas as rotas
-func NewRouter(db *sql.DB, jobProcessor interface{}, syncManager *database.SyncManager, apiKey string) *mux.Router {
+func NewRouter(db *sql.DB, jobProcessor interface{}, scheduler *worker.Scheduler, syncManager *database.SyncManager, cfg *config.Config) *mux.Router {
 	router := mux.NewRouter()
 
 	handlers := NewHandlers(db, jobProcessor.(*worker.JobProcessor))
 	handlers.SetSyncManager(syncManager)
+	handlers.SetScheduler(scheduler)
+	handlers.SetIdempotencyWindow(cfg.IdempotencyWindow)
+	handlers.SetRetentionDays(cfg.JobRetentionDays)
 
 	// Configurar função de enfileiramento
-	handlers.SetEnqueueJobFunc(func(ctx context.Context, payload map[string]interface{}) (string, error) {
-		jobType := "MANUAL"
-		if t, ok := payload["type"].(string); ok {
-			jobType = t
-		}
-		priority := 0
-		if p, ok := payload["priority"].(float64); ok {
-			priority = int(p)
-		}
-		return EnqueueJob(db, jobType, priority, payload)
+	handlers.SetEnqueueJobFunc(func(ctx context.Context, req models.EnqueueRequest) (string, error) {
+		return EnqueueJob(ctx, db, req)
 	})
 
 	// Middlewares
 	router.Use(CORSMiddleware)
-	router.Use(APIKeyMiddleware(apiKey))
+	router.Use(APIKeyMiddleware(cfg.GOWorkerAPIKey))
 	router.Use(LoggingMiddleware)
 
 	// Rotas
 	api := router.PathPrefix("/api/v1").Subrouter()
 
 	// Jobs
+	api.HandleFunc("/jobs", handlers.ListJobsHandler).Methods("GET")
 	api.HandleFunc("/jobs/enqueue", handlers.EnqueueJobHandler).Methods("POST", "OPTIONS")
 	api.HandleFunc("/jobs/{id}/status", handlers.JobStatusHandler).Methods("GET")
+	api.HandleFunc("/jobs/{id}/cancel", handlers.CancelJobHandler).Methods("POST", "OPTIONS")
 	api.HandleFunc("/jobs/queue", handlers.QueueHandler).Methods("GET")
+	api.HandleFunc("/jobs/retention", handlers.RetentionReportHandler).Methods("GET")
+
+	// Dead-letter (jobs que esgotaram as tentativas)
+	api.HandleFunc("/jobs/dead-letter", handlers.DeadLetterHandler).Methods("GET")
+	api.HandleFunc("/jobs/dead-letter/requeue", handlers.DeadLetterRequeueHandler).Methods("POST", "OPTIONS")
+	api.HandleFunc("/jobs/dead-letter/discard", handlers.DeadLetterDiscardHandler).Methods("POST", "OPTIONS")
+	api.HandleFunc("/jobs/{id}/requeue", handlers.DeadLetterRequeueHandler).Methods("POST", "OPTIONS")
+	api.HandleFunc("/jobs/{id}/discard", handlers.DeadLetterDiscardHandler).Methods("POST", "OPTIONS")
+
+	// Agendamentos recorrentes de exportação
+	api.HandleFunc("/schedules", handlers.ListSchedulesHandler).Methods("GET")
+	api.HandleFunc("/schedules", handlers.CreateScheduleHandler).Methods("POST", "OPTIONS")
+	api.HandleFunc("/schedules/{id}", handlers.GetScheduleHandler).Methods("GET")
+	api.HandleFunc("/schedules/{id}", handlers.UpdateScheduleHandler).Methods("PUT", "OPTIONS")
+	api.HandleFunc("/schedules/{id}", handlers.DeleteScheduleHandler).Methods("DELETE", "OPTIONS")
 
 	// Export
 	api.HandleFunc("/export/csv", handlers.ExportCSVHandler).Methods("GET")
@@ -50,8 +64,9 @@ func NewRouter(db *sql.DB, jobProcessor interface{}, syncManager *database.SyncM
 	api.HandleFunc("/sync/status", handlers.SyncStatusHandler).Methods("GET")
 	api.HandleFunc("/sync", handlers.SyncNowHandler).Methods("POST", "OPTIONS")
 
-	// Health
+	// Health e métricas
 	api.HandleFunc("/health", handlers.HealthHandler).Methods("GET")
+	api.HandleFunc("/metrics", handlers.MetricsHandler).Methods("GET")
 
 	return router
 }
@@ -0,0 +1,177 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"educasa/internal/database"
+	"educasa/internal/models"
+	"educasa/internal/worker"
+
+	"github.com/gorilla/mux"
+)
+
+// scheduleRequest é o corpo aceito na criação e atualização de agendamentos
+type scheduleRequest struct {
+	Name         string   `json:"name"`
+	Cron         string   `json:"cron"`
+	TargetType   string   `json:"target_type"`
+	TargetIDs    []string `json:"target_ids"`
+	Period       string   `json:"period"`
+	DeliveryMode string   `json:"delivery_mode"`
+	ToEmail      string   `json:"to_email"`
+	Enabled      *bool    `json:"enabled"`
+}
+
+// ListSchedulesHandler lista os agendamentos de exportação
+func (h *Handlers) ListSchedulesHandler(w http.ResponseWriter, r *http.Request) {
+	schedules, err := database.ListSchedules(r.Context(), h.db)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"schedules": schedules,
+	})
+}
+
+// GetScheduleHandler retorna um agendamento
+func (h *Handlers) GetScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	schedule, err := database.GetSchedule(r.Context(), h.db, mux.Vars(r)["id"])
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Schedule not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(schedule)
+}
+
+// CreateScheduleHandler cria um agendamento e o carrega no scheduler
+func (h *Handlers) CreateScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	schedule, ok := decodeSchedule(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+
+	if err := database.CreateSchedule(ctx, h.db, schedule); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.reloadSchedules(r)
+	h.writeSchedule(w, r, schedule.ID, http.StatusCreated)
+}
+
+// UpdateScheduleHandler substitui um agendamento e o recarrega no scheduler
+func (h *Handlers) UpdateScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	schedule, ok := decodeSchedule(w, r)
+	if !ok {
+		return
+	}
+	schedule.ID = mux.Vars(r)["id"]
+
+	updated, err := database.UpdateSchedule(r.Context(), h.db, schedule)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !updated {
+		http.Error(w, "Schedule not found", http.StatusNotFound)
+		return
+	}
+
+	h.reloadSchedules(r)
+	h.writeSchedule(w, r, schedule.ID, http.StatusOK)
+}
+
+// DeleteScheduleHandler remove um agendamento e o tira do scheduler
+func (h *Handlers) DeleteScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	deleted, err := database.DeleteSchedule(r.Context(), h.db, mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		http.Error(w, "Schedule not found", http.StatusNotFound)
+		return
+	}
+
+	h.reloadSchedules(r)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeSchedule lê e valida o corpo da requisição.
+// Em caso de erro a resposta 400 já foi escrita e ok é false.
+func decodeSchedule(w http.ResponseWriter, r *http.Request) (*models.ExportSchedule, bool) {
+	var req scheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeValidationError(w, models.FieldError{Field: "body", Message: err.Error()})
+		return nil, false
+	}
+
+	schedule := &models.ExportSchedule{
+		Name:         req.Name,
+		Cron:         req.Cron,
+		TargetType:   req.TargetType,
+		TargetIDs:    req.TargetIDs,
+		Period:       req.Period,
+		DeliveryMode: req.DeliveryMode,
+		ToEmail:      req.ToEmail,
+		Enabled:      req.Enabled == nil || *req.Enabled,
+	}
+	if schedule.DeliveryMode == "" {
+		schedule.DeliveryMode = models.DeliveryModeRecipient
+	}
+	if schedule.TargetIDs == nil {
+		schedule.TargetIDs = []string{}
+	}
+
+	fieldErrors := schedule.Validate()
+	if schedule.Cron != "" {
+		if err := worker.ParseCron(schedule.Cron); err != nil {
+			fieldErrors = append(fieldErrors, models.FieldError{Field: "cron", Message: err.Error()})
+		}
+	}
+	if len(fieldErrors) > 0 {
+		writeValidationError(w, fieldErrors...)
+		return nil, false
+	}
+
+	return schedule, true
+}
+
+// reloadSchedules aplica as alterações no scheduler desta réplica.
+// As demais réplicas recebem a mudança no próximo polling.
+func (h *Handlers) reloadSchedules(r *http.Request) {
+	if h.scheduler == nil {
+		return
+	}
+	if err := h.scheduler.ReloadSchedules(r.Context()); err != nil {
+		log.Printf("Error reloading export schedules: %v", err)
+	}
+}
+
+// writeSchedule responde com o agendamento como gravado no banco
+func (h *Handlers) writeSchedule(w http.ResponseWriter, r *http.Request, id string, status int) {
+	schedule, err := database.GetSchedule(r.Context(), h.db, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(schedule)
+}
@@ -1,8 +1,10 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -12,19 +14,38 @@ type Config struct {
 	TursoAuthToken   string
 
 	// Embedded Replica Configuration
-	DBMode           string        // "cloud" ou "embedded"
-	DBLocalPath      string        // Caminho do arquivo local
-	DBSyncInterval   time.Duration // Intervalo de sync automático
-	DBEncryptionKey  string        // Chave de criptografia opcional
+	DBMode          string        // "cloud" ou "embedded"
+	DBLocalPath     string        // Caminho do arquivo local
+	DBSyncInterval  time.Duration // Intervalo de sync automático
+	DBEncryptionKey string        // Chave de criptografia opcional
 
 	// SMTP Email
-	SMTPHost     string
-	SMTPPort     int
-	SMTPUsername string
-	SMTPPassword string
+	SMTPHost      string
+	SMTPPort      int
+	SMTPUsername  string
+	SMTPPassword  string
 	SMTPFromEmail string
 	SMTPFromName  string
 
+	// Segurança SMTP
+	SMTPTLSMode       string // "starttls", "implicit" (porta 465) ou "none" (relay local)
+	SMTPAuthMechanism string // "plain", "login", "cram-md5" ou "none"
+	SMTPCAFile        string // Bundle de CAs (PEM) para validar o servidor; vazio usa os do sistema
+
+	// Backend de envio: "smtp", "outbox" (arquivos .eml) ou "http" (API transacional)
+	MailBackend    string
+	MailOutboxDir  string
+	MailAPIURL     string
+	MailAPIToken   string
+	MailAPITimeout time.Duration
+
+	// Limites de envio do provedor (0 = sem limite). O por minuto vale por réplica;
+	// a cota diária é contada no banco, compartilhada por todas as réplicas,
+	// e vira à meia-noite de MailRateTimezone
+	MailRatePerMinute int
+	MailRatePerDay    int
+	MailRateTimezone  string
+
 	// API Security
 	GOWorkerAPIKey string
 
@@ -33,16 +54,41 @@ type Config struct {
 	MaxConcurrentJobs  int
 	WorkerPollInterval time.Duration
 	JobTimeout         time.Duration
+	WorkerID           string        // Identifica o dono do lease de um job
+	JobLeaseDuration   time.Duration // Validade do lease, renovado durante o processamento
+	ReaperInterval     time.Duration // Intervalo de recuperação de jobs presos em PROCESSING
+
+	// Retry (backoff exponencial)
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+	RetryPolicies  map[string]RetryPolicyConfig // Sobrescritas por tipo de job
+
+	// Export
+	ExportToEmail     string
+	IdempotencyWindow time.Duration // Janela em que enqueues com a mesma Idempotency-Key são deduplicados
 
 	// Scheduler
 	EnableScheduler bool
 	MonthlyCron     string
 
+	// Entrega do relatório mensal: "RECIPIENT" (email para cada aluno) ou "BATCH" (EXPORT_TO_EMAIL)
+	MonthlyDeliveryMode string
+
+	// Intervalo de recarga da tabela export_schedules (alterações feitas por outras réplicas)
+	ScheduleReloadInterval time.Duration
+
+	// Retenção: jobs finalizados há mais de JobRetentionDays são removidos (0, o padrão, desativa)
+	JobRetentionDays int
+	RetentionCron    string
+
 	// Server
 	ServerPort string
 	ServerHost string
 	LogLevel   string
 	LogFormat  string
+
+	// Tempo máximo para drenar jobs em andamento no desligamento
+	ShutdownTimeout time.Duration
 }
 
 func Load() (*Config, error) {
@@ -68,19 +114,58 @@ func Load() (*Config, error) {
 		SMTPPassword:       getEnv("SMTP_PASSWORD", ""),
 		SMTPFromEmail:      getEnv("SMTP_FROM_EMAIL", "noreply@educasa.app.br"),
 		SMTPFromName:       getEnv("SMTP_FROM_NAME", "Educa.SA"),
+		SMTPTLSMode:        strings.ToLower(getEnv("SMTP_TLS_MODE", "")),
+		SMTPAuthMechanism:  strings.ToLower(getEnv("SMTP_AUTH_MECHANISM", "plain")),
+		SMTPCAFile:         getEnv("SMTP_CA_FILE", ""),
+		MailBackend:        strings.ToLower(getEnv("MAIL_BACKEND", "smtp")),
+		MailOutboxDir:      getEnv("MAIL_OUTBOX_DIR", "/data/outbox"),
+		MailAPIURL:         getEnv("MAIL_API_URL", "https://api.zeptomail.com/v1.1/email"),
+		MailAPIToken:       getEnv("MAIL_API_TOKEN", ""),
+		MailAPITimeout:     getEnvDuration("MAIL_API_TIMEOUT", 30*time.Second),
+		MailRatePerMinute:  getEnvInt("MAIL_RATE_PER_MINUTE", 0),
+		MailRatePerDay:     getEnvInt("MAIL_RATE_PER_DAY", 0),
+		MailRateTimezone:   getEnv("MAIL_RATE_TIMEZONE", "UTC"),
 		GOWorkerAPIKey:     getEnv("GO_WORKER_API_KEY", ""),
 		BatchSize:          getEnvInt("BATCH_SIZE", 20),
 		MaxConcurrentJobs:  getEnvInt("MAX_CONCURRENT_JOBS", 3),
 		WorkerPollInterval: getEnvDuration("WORKER_POLL_INTERVAL", 1*time.Minute),
-		JobTimeout:         getEnvDuration("JOB_TIMEOUT_MINUTES", 30*time.Minute) * time.Duration(getEnvInt("JOB_TIMEOUT_MINUTES", 30)),
+		JobTimeout:         time.Duration(getEnvInt("JOB_TIMEOUT_MINUTES", 30)) * time.Minute,
+		ExportToEmail:      getEnv("EXPORT_TO_EMAIL", ""),
+		IdempotencyWindow:  getEnvDuration("IDEMPOTENCY_WINDOW", 24*time.Hour),
+		WorkerID:           getEnv("WORKER_ID", defaultWorkerID()),
+		JobLeaseDuration:   getEnvDuration("JOB_LEASE_DURATION", 5*time.Minute),
+		ReaperInterval:     getEnvDuration("REAPER_INTERVAL", 1*time.Minute),
+		RetryBaseDelay:     getEnvDuration("RETRY_BASE_DELAY", 1*time.Minute),
+		RetryMaxDelay:      getEnvDuration("RETRY_MAX_DELAY", 1*time.Hour),
 		EnableScheduler:    getEnvBool("ENABLE_SCHEDULER", true),
 		MonthlyCron:        getEnv("MONTHLY_CRON", "0 0 1 * *"),
+		JobRetentionDays:   getEnvInt("JOB_RETENTION_DAYS", 0),
+		RetentionCron:      getEnv("RETENTION_CRON", "0 3 * * *"),
 		ServerPort:         getEnv("SERVER_PORT", "8080"),
 		ServerHost:         getEnv("SERVER_HOST", "0.0.0.0"),
 		LogLevel:           getEnv("GO_LOG_LEVEL", "info"),
 		LogFormat:          getEnv("GO_LOG_FORMAT", "json"),
+		ShutdownTimeout:    getEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second),
+
+		// Scheduler
+		MonthlyDeliveryMode:    getEnv("MONTHLY_DELIVERY_MODE", "RECIPIENT"),
+		ScheduleReloadInterval: getEnvDuration("SCHEDULE_RELOAD_INTERVAL", 1*time.Minute),
 	}
 
+	// Porta 465 usa TLS implícito; as demais, STARTTLS
+	if cfg.SMTPTLSMode == "" {
+		cfg.SMTPTLSMode = "starttls"
+		if cfg.SMTPPort == 465 {
+			cfg.SMTPTLSMode = "implicit"
+		}
+	}
+
+	retryPolicies, err := parseRetryPolicies(getEnv("RETRY_POLICIES", ""))
+	if err != nil {
+		return nil, err
+	}
+	cfg.RetryPolicies = retryPolicies
+
 	if err := cfg.Validate(); err != nil {
 		return nil, err
 	}
@@ -95,6 +180,49 @@ func (c *Config) Validate() error {
 	if c.GOWorkerAPIKey == "" {
 		return &ConfigError{Field: "GO_WORKER_API_KEY", Message: "is required"}
 	}
+	if c.JobLeaseDuration < 3*time.Second {
+		return &ConfigError{Field: "JOB_LEASE_DURATION", Message: "must be at least 3s"}
+	}
+	if c.ReaperInterval <= 0 {
+		return &ConfigError{Field: "REAPER_INTERVAL", Message: "must be positive"}
+	}
+	if c.MailRatePerMinute < 0 {
+		return &ConfigError{Field: "MAIL_RATE_PER_MINUTE", Message: "must not be negative"}
+	}
+	if c.MailRatePerDay < 0 {
+		return &ConfigError{Field: "MAIL_RATE_PER_DAY", Message: "must not be negative"}
+	}
+	if _, err := time.LoadLocation(c.MailRateTimezone); err != nil {
+		return &ConfigError{Field: "MAIL_RATE_TIMEZONE", Message: "must be an IANA time zone (e.g. UTC, America/Sao_Paulo)"}
+	}
+	if c.JobRetentionDays < 0 {
+		return &ConfigError{Field: "JOB_RETENTION_DAYS", Message: "must not be negative"}
+	}
+	switch c.SMTPTLSMode {
+	case "starttls", "implicit", "none":
+	default:
+		return &ConfigError{Field: "SMTP_TLS_MODE", Message: "must be starttls, implicit or none"}
+	}
+	switch c.SMTPAuthMechanism {
+	case "plain", "login", "cram-md5", "none":
+	default:
+		return &ConfigError{Field: "SMTP_AUTH_MECHANISM", Message: "must be plain, login, cram-md5 or none"}
+	}
+	switch c.MailBackend {
+	case "smtp", "outbox":
+	case "http":
+		if c.MailAPIToken == "" {
+			return &ConfigError{Field: "MAIL_API_TOKEN", Message: "is required when MAIL_BACKEND is http"}
+		}
+	default:
+		return &ConfigError{Field: "MAIL_BACKEND", Message: "must be smtp, outbox or http"}
+	}
+	if c.MonthlyDeliveryMode != "RECIPIENT" && c.MonthlyDeliveryMode != "BATCH" {
+		return &ConfigError{Field: "MONTHLY_DELIVERY_MODE", Message: "must be RECIPIENT or BATCH"}
+	}
+	if c.ScheduleReloadInterval <= 0 {
+		return &ConfigError{Field: "SCHEDULE_RELOAD_INTERVAL", Message: "must be positive"}
+	}
 	return nil
 }
 
@@ -107,6 +235,55 @@ func (e *ConfigError) Error() string {
 	return e.Field + " " + e.Message
 }
 
+// RetryPolicyConfig define o backoff de um tipo de job
+type RetryPolicyConfig struct {
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// parseRetryPolicies lê sobrescritas no formato "TIPO=base:max,TIPO=base:max",
+// ex: "MONTHLY_AUTO=5m:6h,MANUAL=30s:30m"
+func parseRetryPolicies(value string) (map[string]RetryPolicyConfig, error) {
+	policies := make(map[string]RetryPolicyConfig)
+	if value == "" {
+		return policies, nil
+	}
+
+	for _, entry := range strings.Split(value, ",") {
+		jobType, delays, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			return nil, &ConfigError{Field: "RETRY_POLICIES", Message: "invalid entry " + entry}
+		}
+
+		baseStr, maxStr, ok := strings.Cut(delays, ":")
+		if !ok {
+			return nil, &ConfigError{Field: "RETRY_POLICIES", Message: "invalid delays for " + jobType}
+		}
+
+		base, err := time.ParseDuration(baseStr)
+		if err != nil {
+			return nil, &ConfigError{Field: "RETRY_POLICIES", Message: "invalid base delay for " + jobType}
+		}
+		max, err := time.ParseDuration(maxStr)
+		if err != nil {
+			return nil, &ConfigError{Field: "RETRY_POLICIES", Message: "invalid max delay for " + jobType}
+		}
+
+		policies[jobType] = RetryPolicyConfig{BaseDelay: base, MaxDelay: max}
+	}
+
+	return policies, nil
+}
+
+// defaultWorkerID identifica a réplica pelo hostname (ID do container) e PID
+func defaultWorkerID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "worker"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// validConfig retorna uma configuração que passa em Validate
+func validConfig() *Config {
+	return &Config{
+		TursoDatabaseURL:    "file:/tmp/worker.db",
+		GOWorkerAPIKey:      "k",
+		JobLeaseDuration:    5 * time.Minute,
+		ReaperInterval:      time.Minute,
+		MailRateTimezone:    "UTC",
+		SMTPTLSMode:         "starttls",
+		SMTPAuthMechanism:   "plain",
+		MailBackend:         "smtp",
+		MonthlyDeliveryMode: "RECIPIENT",
+
+		ScheduleReloadInterval: time.Minute,
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		field  string // Vazio: configuração válida
+	}{
+		{"válida", func(c *Config) {}, ""},
+		{"lease curto", func(c *Config) { c.JobLeaseDuration = time.Second }, "JOB_LEASE_DURATION"},
+		{"reaper zerado", func(c *Config) { c.ReaperInterval = 0 }, "REAPER_INTERVAL"},
+		{"reaper negativo", func(c *Config) { c.ReaperInterval = -time.Minute }, "REAPER_INTERVAL"},
+		{"recarga de agendamentos zerada", func(c *Config) { c.ScheduleReloadInterval = 0 }, "SCHEDULE_RELOAD_INTERVAL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := validConfig()
+			tt.modify(c)
+
+			err := c.Validate()
+			if tt.field == "" {
+				if err != nil {
+					t.Fatalf("erro inesperado: %v", err)
+				}
+				return
+			}
+
+			var configErr *ConfigError
+			if !errors.As(err, &configErr) || configErr.Field != tt.field {
+				t.Errorf("erro = %v, esperado campo %s", err, tt.field)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"educasa/internal/models"
+)
+
+// SaveBatch grava o estado atual de um batch, criando o registro se necessário
+func SaveBatch(ctx context.Context, db *sql.DB, b *models.Batch) error {
+	query := `
+		INSERT INTO export_batches (
+			id, job_id, batch_number, total_batches, status, recipients_count,
+			file_path, email_sent, sent_at, error_message, sent_user_ids, failed_user_ids
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			total_batches = excluded.total_batches,
+			status = excluded.status,
+			recipients_count = excluded.recipients_count,
+			file_path = excluded.file_path,
+			email_sent = excluded.email_sent,
+			sent_at = excluded.sent_at,
+			error_message = excluded.error_message,
+			sent_user_ids = excluded.sent_user_ids,
+			failed_user_ids = excluded.failed_user_ids
+	`
+
+	sentUserIDs, err := nullJSON(b.SentUserIDs)
+	if err != nil {
+		return err
+	}
+	failedUserIDs, err := nullJSON(b.FailedUserIDs)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, query,
+		b.ID,
+		b.JobID,
+		b.BatchNumber,
+		b.TotalBatches,
+		b.Status,
+		b.RecipientsCount,
+		nullString(b.FilePath),
+		b.EmailSent,
+		nullString(b.SentAt),
+		nullString(b.ErrorMessage),
+		sentUserIDs,
+		failedUserIDs,
+	)
+	return err
+}
+
+// nullJSON grava uma lista de IDs como JSON, ou NULL quando vazia
+func nullJSON(ids []string) (sql.NullString, error) {
+	if len(ids) == 0 {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(ids)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+// nullString converte string vazia em NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// Status de EmailExport (enum ExportStatus do Prisma)
+const (
+	EmailExportPending    = "PENDING"
+	EmailExportProcessing = "PROCESSING"
+	EmailExportSent       = "SENT"
+	EmailExportFailed     = "FAILED"
+	EmailExportRetrying   = "RETRYING"
+)
+
+// EmailExportUpdate descreve uma mudança de estado nos registros email_exports
+// (tabela do web-app) ligados a um job
+type EmailExportUpdate struct {
+	RecordID     string   // payload.export_record_id, se informado
+	JobID        string   // Registros com batchId = JobID
+	UserIDs      []string // Restringe aos alunos do batch; vazio = todos do job
+	Status       string
+	BatchNumber  int // Gravados quando > 0
+	TotalBatches int
+	RetryCount   *int
+	ErrorMessage string
+	At           time.Time
+
+	// Alunos preservados: falha definitiva com motivo próprio
+	ExcludeUserIDs []string
+}
+
+// UpdateEmailExports aplica a mudança aos registros do job que ainda não foram enviados.
+// Datas são gravadas como INTEGER em milissegundos desde a época, o mesmo formato
+// que o web-app grava via @prisma/adapter-libsql (conferido em email_exports_test.go
+// contra o banco de desenvolvimento do web-app).
+func UpdateEmailExports(ctx context.Context, db *sql.DB, u EmailExportUpdate) (int64, error) {
+	set := []string{`status = ?`}
+	args := []interface{}{u.Status}
+
+	at := u.At.UnixMilli()
+	switch u.Status {
+	case EmailExportSent:
+		set = append(set, `sentAt = ?`, `errorMessage = NULL`)
+		args = append(args, at)
+	case EmailExportFailed:
+		set = append(set, `failedAt = ?`)
+		args = append(args, at)
+	case EmailExportRetrying:
+		set = append(set, `lastRetryAt = ?`)
+		args = append(args, at)
+	}
+
+	if u.Status != EmailExportSent && u.ErrorMessage != "" {
+		set = append(set, `errorMessage = ?`)
+		args = append(args, u.ErrorMessage)
+	}
+	if u.RetryCount != nil {
+		set = append(set, `retryCount = ?`)
+		args = append(args, *u.RetryCount)
+	}
+	if u.BatchNumber > 0 {
+		set = append(set, `batchNumber = ?`, `totalBatches = ?`)
+		args = append(args, u.BatchNumber, u.TotalBatches)
+	}
+
+	query := `UPDATE email_exports SET ` + strings.Join(set, ", ") + `
+		WHERE (id = ? OR batchId = ?) AND status != 'SENT'`
+	args = append(args, u.RecordID, u.JobID)
+
+	if len(u.UserIDs) > 0 {
+		query += ` AND userId IN (` + sqlPlaceholders(len(u.UserIDs)) + `)`
+		for _, id := range u.UserIDs {
+			args = append(args, id)
+		}
+	}
+	if len(u.ExcludeUserIDs) > 0 {
+		query += ` AND userId NOT IN (` + sqlPlaceholders(len(u.ExcludeUserIDs)) + `)`
+		for _, id := range u.ExcludeUserIDs {
+			args = append(args, id)
+		}
+	}
+
+	res, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// IsMissingTable informa se o erro indica tabela inexistente
+// (ex.: email_exports ainda não migrada pelo web-app)
+func IsMissingTable(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "no such table")
+}
@@ -0,0 +1,176 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// webAppDB é o banco de desenvolvimento do web-app, gravado pelo Prisma via @prisma/adapter-libsql
+var webAppDB = filepath.Join("..", "..", "..", "web-app", "prisma", "database", "educasa_dev.db")
+
+// openWebAppDB abre uma cópia do banco do web-app
+func openWebAppDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	data, err := os.ReadFile(webAppDB)
+	if err != nil {
+		t.Skipf("banco do web-app indisponível: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "webapp.db")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("libsql", "file:"+path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestUpdateEmailExportsUsesWebAppDateFormat(t *testing.T) {
+	ctx := context.Background()
+	db := openWebAppDB(t)
+
+	// users.updatedAt não tem default no schema: o valor foi gravado pelo client do Prisma
+	var userID, userEmail, userName, webAppType string
+	var webAppUpdatedAt int64
+	err := db.QueryRowContext(ctx,
+		`SELECT id, email, name, typeof(updatedAt), updatedAt FROM users WHERE typeof(updatedAt) = 'integer' LIMIT 1`,
+	).Scan(&userID, &userEmail, &userName, &webAppType, &webAppUpdatedAt)
+	if err != nil {
+		t.Fatalf("nenhum usuário com updatedAt gravado pelo web-app: %v", err)
+	}
+
+	tests := []struct {
+		status string
+		column string
+	}{
+		{EmailExportSent, "sentAt"},
+		{EmailExportFailed, "failedAt"},
+		{EmailExportRetrying, "lastRetryAt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			jobID := "job_" + tt.status
+			recordID := "rec_" + tt.status
+
+			// Registro como o web-app cria ao enfileirar (datas no mesmo formato de users.updatedAt)
+			start := time.Date(2025, 1, 1, 3, 0, 0, 0, time.UTC)
+			_, err := db.ExecContext(ctx, `
+				INSERT INTO email_exports (id, userId, userEmail, userName, type, status, startDate, endDate,
+					batchId, recipientsCount, toEmail, subject, createdAt)
+				VALUES (?, ?, ?, ?, 'MANUAL', 'PENDING', ?, ?, ?, 1, ?, 'Exportação', ?)
+			`, recordID, userID, userEmail, userName, start.UnixMilli(), start.AddDate(0, 1, 0).UnixMilli(),
+				jobID, userEmail, webAppUpdatedAt)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			at := time.Date(2025, 2, 1, 12, 30, 45, 123_000_000, time.UTC)
+			n, err := UpdateEmailExports(ctx, db, EmailExportUpdate{
+				RecordID:     recordID,
+				JobID:        jobID,
+				Status:       tt.status,
+				BatchNumber:  1,
+				TotalBatches: 2,
+				ErrorMessage: "erro",
+				At:           at,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != 1 {
+				t.Fatalf("registros atualizados = %d, esperado 1", n)
+			}
+
+			var status, gotType string
+			var got int64
+			err = db.QueryRowContext(ctx,
+				`SELECT status, typeof(`+tt.column+`), `+tt.column+` FROM email_exports WHERE id = ?`, recordID,
+			).Scan(&status, &gotType, &got)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if status != tt.status {
+				t.Errorf("status = %s, esperado %s", status, tt.status)
+			}
+			if gotType != webAppType {
+				t.Errorf("%s gravado como %s, o web-app grava %s", tt.column, gotType, webAppType)
+			}
+			if !time.UnixMilli(got).Equal(at) {
+				t.Errorf("%s = %v, esperado %v", tt.column, time.UnixMilli(got).UTC(), at)
+			}
+		})
+	}
+}
+
+func TestUpdateEmailExportsKeepsExcludedUsers(t *testing.T) {
+	ctx := context.Background()
+	db := openWebAppDB(t)
+
+	rows, err := db.QueryContext(ctx, `SELECT id, email, name FROM users ORDER BY id LIMIT 2`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var users [][3]string
+	for rows.Next() {
+		var u [3]string
+		if err := rows.Scan(&u[0], &u[1], &u[2]); err != nil {
+			t.Fatal(err)
+		}
+		users = append(users, u)
+	}
+	rows.Close()
+	if len(users) < 2 {
+		t.Skip("banco do web-app com menos de 2 usuários")
+	}
+
+	const jobID = "job_exclude"
+	now := time.Now().UnixMilli()
+	for i, u := range users {
+		_, err := db.ExecContext(ctx, `
+			INSERT INTO email_exports (id, userId, userEmail, userName, type, status, startDate, endDate,
+				batchId, recipientsCount, toEmail, subject, createdAt)
+			VALUES (?, ?, ?, ?, 'MANUAL', 'PENDING', ?, ?, ?, 1, ?, 'Exportação', ?)
+		`, fmt.Sprintf("rec_%d", i), u[0], u[1], u[2], now, now, jobID, u[1], now)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Falha do próprio aluno, depois falha do job inteiro
+	updates := []EmailExportUpdate{
+		{JobID: jobID, Status: EmailExportFailed, UserIDs: []string{users[0][0]}, ErrorMessage: "Email recusado"},
+		{JobID: jobID, Status: EmailExportFailed, ExcludeUserIDs: []string{users[0][0]}, ErrorMessage: "aluno não incluído na exportação"},
+	}
+	for _, u := range updates {
+		u.At = time.Now()
+		if _, err := UpdateEmailExports(ctx, db, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := map[string]string{
+		users[0][0]: "Email recusado",
+		users[1][0]: "aluno não incluído na exportação",
+	}
+	for userID, reason := range want {
+		var got string
+		if err := db.QueryRowContext(ctx, `SELECT errorMessage FROM email_exports WHERE batchId = ? AND userId = ?`, jobID, userID).Scan(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != reason {
+			t.Errorf("errorMessage de %s = %q, esperado %q", userID, got, reason)
+		}
+	}
+}
@@ -0,0 +1,633 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"educasa/internal/models"
+)
+
+// TimeLayout é o formato usado pelo SQLite em CURRENT_TIMESTAMP (UTC)
+const TimeLayout = "2006-01-02 15:04:05"
+
+// FormatTime formata um horário no mesmo layout de CURRENT_TIMESTAMP,
+// permitindo comparações diretas entre strings no SQL
+func FormatTime(t time.Time) string {
+	return t.UTC().Format(TimeLayout)
+}
+
+// jobColumns lista as colunas na ordem esperada por models.ScanJob
+const jobColumns = `id, type, status, priority, payload, result, error_message,
+		       created_at, started_at, completed_at, retry_count, max_retries, last_retry_at,
+		       lease_owner, lease_expires_at, next_attempt_at, cancel_requested_at, idempotency_key, run_at`
+
+// runnableCondition seleciona jobs prontos para rodar: pendentes ou aguardando retry,
+// com backoff (next_attempt_at) e agendamento (run_at) já vencidos.
+// Recebe o instante atual duas vezes como argumento.
+const runnableCondition = `(status = 'PENDING' OR (status = 'FAILED' AND retry_count < max_retries))
+		  AND (next_attempt_at IS NULL OR next_attempt_at <= ?)
+		  AND (run_at IS NULL OR run_at <= ?)`
+
+// batchColumns lista as colunas na ordem esperada por models.ScanBatch
+const batchColumns = `id, job_id, batch_number, total_batches, status, recipients_count,
+		       file_path, email_sent, sent_at, error_message, created_at, sent_user_ids, failed_user_ids`
+
+// GetJob busca um job pelo ID. Retorna sql.ErrNoRows se não existir.
+func GetJob(ctx context.Context, db *sql.DB, jobID string) (*models.Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM export_jobs WHERE id = ?`
+
+	rows, err := db.QueryContext(ctx, query, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, sql.ErrNoRows
+	}
+
+	return models.ScanJob(rows)
+}
+
+// GetJobBatches busca os batches de um job ordenados pelo número
+func GetJobBatches(ctx context.Context, db *sql.DB, jobID string) ([]models.Batch, error) {
+	query := `SELECT ` + batchColumns + ` FROM export_batches WHERE job_id = ? ORDER BY batch_number ASC`
+
+	rows, err := db.QueryContext(ctx, query, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	batches := []models.Batch{}
+	for rows.Next() {
+		batch, err := models.ScanBatch(rows)
+		if err != nil {
+			return nil, err
+		}
+		batches = append(batches, *batch)
+	}
+
+	return batches, rows.Err()
+}
+
+// GetPendingJobs busca candidatos a processamento por prioridade e ordem de criação.
+// Os jobs retornados ainda precisam ser reivindicados com ClaimJob.
+func GetPendingJobs(ctx context.Context, db *sql.DB, limit int) ([]models.Job, error) {
+	query := `SELECT ` + jobColumns + `
+		FROM export_jobs
+		WHERE ` + runnableCondition + `
+		ORDER BY priority DESC, created_at ASC
+		LIMIT ?
+	`
+
+	now := FormatTime(time.Now())
+	rows, err := db.QueryContext(ctx, query, now, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []models.Job{}
+	for rows.Next() {
+		job, err := models.ScanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *job)
+	}
+
+	return jobs, rows.Err()
+}
+
+// Ordenações aceitas por ListJobs
+const (
+	JobSortCreatedAt = "created_at"
+	JobSortPriority  = "priority"
+)
+
+// JobFilter define os filtros e a página de ListJobs
+type JobFilter struct {
+	Statuses    []string
+	Type        string
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	UserID      string // Jobs cujo payload.user_ids contém o usuário
+	Sort        string // JobSortCreatedAt (padrão) ou JobSortPriority
+	Ascending   bool
+	After       *JobCursor // Continua após este job, na ordenação escolhida
+	Limit       int
+}
+
+// JobCursor identifica a posição de um job na listagem
+type JobCursor struct {
+	Priority  int    `json:"p"`
+	CreatedAt string `json:"c"`
+	ID        string `json:"id"`
+}
+
+// CursorFor retorna o cursor que aponta para o job
+func CursorFor(job models.Job) JobCursor {
+	return JobCursor{Priority: job.Priority, CreatedAt: FormatTime(job.CreatedAt), ID: job.ID}
+}
+
+// ListJobs lista jobs com filtros e paginação por cursor (keyset)
+func ListJobs(ctx context.Context, db *sql.DB, f JobFilter) ([]models.Job, error) {
+	var where []string
+	var args []interface{}
+
+	if len(f.Statuses) > 0 {
+		where = append(where, `status IN (`+sqlPlaceholders(len(f.Statuses))+`)`)
+		for _, st := range f.Statuses {
+			args = append(args, st)
+		}
+	}
+	if f.Type != "" {
+		where = append(where, `type = ?`)
+		args = append(args, f.Type)
+	}
+	if f.CreatedFrom != nil {
+		where = append(where, `created_at >= ?`)
+		args = append(args, FormatTime(*f.CreatedFrom))
+	}
+	if f.CreatedTo != nil {
+		where = append(where, `created_at <= ?`)
+		args = append(args, FormatTime(*f.CreatedTo))
+	}
+	if f.UserID != "" {
+		where = append(where, `EXISTS (SELECT 1 FROM json_each(payload, '$.user_ids') WHERE value = ?)`)
+		args = append(args, f.UserID)
+	}
+
+	// Chave de ordenação; id desempata jobs criados no mesmo segundo
+	keys := `created_at, id`
+	if f.Sort == JobSortPriority {
+		keys = `priority, created_at, id`
+	}
+
+	direction, cmp := `DESC`, `<`
+	if f.Ascending {
+		direction, cmp = `ASC`, `>`
+	}
+
+	if f.After != nil {
+		where = append(where, `(`+keys+`) `+cmp+` (`+sqlPlaceholders(strings.Count(keys, ",")+1)+`)`)
+		if f.Sort == JobSortPriority {
+			args = append(args, f.After.Priority)
+		}
+		args = append(args, f.After.CreatedAt, f.After.ID)
+	}
+
+	query := `SELECT ` + jobColumns + ` FROM export_jobs`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, ` AND `)
+	}
+
+	order := strings.Split(keys, ", ")
+	for i := range order {
+		order[i] += ` ` + direction
+	}
+	query += ` ORDER BY ` + strings.Join(order, `, `) + ` LIMIT ?`
+	args = append(args, f.Limit)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []models.Job{}
+	for rows.Next() {
+		job, err := models.ScanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *job)
+	}
+
+	return jobs, rows.Err()
+}
+
+// ClaimJob reivindica um job para o worker owner com um UPDATE condicional.
+// Retorna false se outro worker já o reivindicou.
+func ClaimJob(ctx context.Context, db *sql.DB, jobID, owner string, leaseUntil time.Time) (bool, error) {
+	query := `
+		UPDATE export_jobs
+		SET status = 'PROCESSING',
+		    started_at = ?,
+		    completed_at = NULL,
+		    lease_owner = ?,
+		    lease_expires_at = ?
+		WHERE id = ?
+		  AND ` + runnableCondition + `
+	`
+
+	now := FormatTime(time.Now())
+	res, err := db.ExecContext(ctx, query, now, owner, FormatTime(leaseUntil), jobID, now, now)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// RenewLease estende o lease de um job em processamento.
+// Retorna false se o worker não é mais o dono do job.
+func RenewLease(ctx context.Context, db *sql.DB, jobID, owner string, leaseUntil time.Time) (bool, error) {
+	query := `
+		UPDATE export_jobs
+		SET lease_expires_at = ?
+		WHERE id = ? AND lease_owner = ? AND status = 'PROCESSING'
+	`
+
+	res, err := db.ExecContext(ctx, query, FormatTime(leaseUntil), jobID, owner)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// FinishJob grava o status final de um job e libera o lease do worker owner
+func FinishJob(ctx context.Context, db *sql.DB, jobID, owner, status string, result map[string]interface{}, errorMessage string) error {
+	var resultJSON sql.NullString
+	if result != nil {
+		resultBytes, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		resultJSON = sql.NullString{String: string(resultBytes), Valid: true}
+	}
+
+	query := `
+		UPDATE export_jobs
+		SET status = ?,
+		    completed_at = ?,
+		    result = ?,
+		    error_message = ?,
+		    lease_owner = NULL,
+		    lease_expires_at = NULL
+		WHERE id = ? AND lease_owner = ?
+	`
+
+	_, err := db.ExecContext(ctx, query, status, FormatTime(time.Now()), resultJSON, nullString(errorMessage), jobID, owner)
+	return err
+}
+
+// RequeueJob devolve um job à fila para nova tentativa a partir de nextAttemptAt
+// e libera o lease do worker owner
+func RequeueJob(ctx context.Context, db *sql.DB, jobID, owner string, retryCount int, nextAttemptAt time.Time, errorMessage string) error {
+	query := `
+		UPDATE export_jobs
+		SET status = 'PENDING',
+		    retry_count = ?,
+		    last_retry_at = ?,
+		    next_attempt_at = ?,
+		    error_message = ?,
+		    lease_owner = NULL,
+		    lease_expires_at = NULL
+		WHERE id = ? AND lease_owner = ?
+	`
+
+	_, err := db.ExecContext(ctx, query, retryCount, FormatTime(time.Now()), FormatTime(nextAttemptAt), nullString(errorMessage), jobID, owner)
+	return err
+}
+
+// FailJob marca um job como FAILED permanentemente após esgotar as tentativas
+func FailJob(ctx context.Context, db *sql.DB, jobID, owner string, retryCount int, errorMessage string) error {
+	query := `
+		UPDATE export_jobs
+		SET status = 'FAILED',
+		    retry_count = ?,
+		    completed_at = ?,
+		    error_message = ?,
+		    lease_owner = NULL,
+		    lease_expires_at = NULL
+		WHERE id = ? AND lease_owner = ?
+	`
+
+	_, err := db.ExecContext(ctx, query, retryCount, FormatTime(time.Now()), nullString(errorMessage), jobID, owner)
+	return err
+}
+
+// GetProcessingJobs busca todos os jobs em PROCESSING
+func GetProcessingJobs(ctx context.Context, db *sql.DB) ([]models.Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM export_jobs WHERE status = 'PROCESSING'`
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []models.Job{}
+	for rows.Next() {
+		job, err := models.ScanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *job)
+	}
+
+	return jobs, rows.Err()
+}
+
+// RecoverJob devolve um job preso em PROCESSING para PENDING, FAILED ou CANCELLED.
+// A atualização só ocorre se o lease não mudou desde a leitura do job.
+func RecoverJob(ctx context.Context, db *sql.DB, job models.Job, status string, retryCount int, nextAttemptAt time.Time, errorMessage string) (bool, error) {
+	var leaseExpiresAt sql.NullString
+	if job.LeaseExpiresAt != nil {
+		leaseExpiresAt = sql.NullString{String: FormatTime(*job.LeaseExpiresAt), Valid: true}
+	}
+
+	var completedAt sql.NullString
+	if status != "PENDING" {
+		completedAt = sql.NullString{String: FormatTime(time.Now()), Valid: true}
+	}
+
+	query := `
+		UPDATE export_jobs
+		SET status = ?,
+		    retry_count = ?,
+		    last_retry_at = ?,
+		    next_attempt_at = ?,
+		    completed_at = ?,
+		    error_message = ?,
+		    lease_owner = NULL,
+		    lease_expires_at = NULL
+		WHERE id = ?
+		  AND status = 'PROCESSING'
+		  AND lease_owner IS ?
+		  AND lease_expires_at IS ?
+	`
+
+	res, err := db.ExecContext(ctx, query,
+		status, retryCount, FormatTime(time.Now()), FormatTime(nextAttemptAt), completedAt, nullString(errorMessage),
+		job.ID, job.LeaseOwner, leaseExpiresAt,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// ReleaseJob devolve um job à fila sem contar tentativa (ex: desligamento do worker)
+func ReleaseJob(ctx context.Context, db *sql.DB, jobID, owner string) error {
+	query := `
+		UPDATE export_jobs
+		SET status = 'PENDING',
+		    lease_owner = NULL,
+		    lease_expires_at = NULL
+		WHERE id = ? AND lease_owner = ?
+	`
+
+	_, err := db.ExecContext(ctx, query, jobID, owner)
+	return err
+}
+
+// DeferJob devolve o job à fila só a partir de nextAttemptAt, sem contar tentativa
+// (ex.: cota de envio esgotada)
+func DeferJob(ctx context.Context, db *sql.DB, jobID, owner string, nextAttemptAt time.Time, reason string) error {
+	query := `
+		UPDATE export_jobs
+		SET status = 'PENDING',
+		    next_attempt_at = ?,
+		    error_message = ?,
+		    lease_owner = NULL,
+		    lease_expires_at = NULL
+		WHERE id = ? AND lease_owner = ?
+	`
+
+	_, err := db.ExecContext(ctx, query, FormatTime(nextAttemptAt), nullString(reason), jobID, owner)
+	return err
+}
+
+// GetJobByIdempotencyKey busca o job criado com a chave de idempotência.
+// Retorna sql.ErrNoRows se nenhum job usa a chave.
+func GetJobByIdempotencyKey(ctx context.Context, db *sql.DB, key string) (*models.Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM export_jobs WHERE idempotency_key = ?`
+
+	rows, err := db.QueryContext(ctx, query, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, sql.ErrNoRows
+	}
+
+	return models.ScanJob(rows)
+}
+
+// ExpireIdempotencyKey libera a chave de jobs criados antes de before,
+// permitindo que ela seja reutilizada por um novo job
+func ExpireIdempotencyKey(ctx context.Context, db *sql.DB, key string, before time.Time) error {
+	query := `
+		UPDATE export_jobs
+		SET idempotency_key = NULL
+		WHERE idempotency_key = ? AND created_at < ?
+	`
+
+	_, err := db.ExecContext(ctx, query, key, FormatTime(before))
+	return err
+}
+
+// CancelPendingJob cancela um job que ainda não está em processamento
+// (PENDING ou aguardando retry)
+func CancelPendingJob(ctx context.Context, db *sql.DB, jobID string) (bool, error) {
+	query := `
+		UPDATE export_jobs
+		SET status = 'CANCELLED',
+		    completed_at = ?,
+		    next_attempt_at = NULL
+		WHERE id = ?
+		  AND (status = 'PENDING' OR (status = 'FAILED' AND retry_count < max_retries))
+	`
+
+	res, err := db.ExecContext(ctx, query, FormatTime(time.Now()), jobID)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// RequestJobCancel marca um job em PROCESSING para parar após o batch atual.
+// O worker dono do job consulta a marca antes de cada batch.
+func RequestJobCancel(ctx context.Context, db *sql.DB, jobID string) (bool, error) {
+	query := `
+		UPDATE export_jobs
+		SET cancel_requested_at = COALESCE(cancel_requested_at, ?)
+		WHERE id = ? AND status = 'PROCESSING'
+	`
+
+	res, err := db.ExecContext(ctx, query, FormatTime(time.Now()), jobID)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// GetJobTargets retorna os IDs de usuários gravados na primeira execução do job.
+// found é false enquanto os alvos ainda não foram resolvidos.
+func GetJobTargets(ctx context.Context, db *sql.DB, jobID string) (userIDs []string, found bool, err error) {
+	var raw sql.NullString
+	err = db.QueryRowContext(ctx,
+		`SELECT target_user_ids FROM export_jobs WHERE id = ?`, jobID,
+	).Scan(&raw)
+	if err != nil || !raw.Valid {
+		return nil, false, err
+	}
+
+	if err := json.Unmarshal([]byte(raw.String), &userIDs); err != nil {
+		return nil, false, err
+	}
+	return userIDs, true, nil
+}
+
+// SaveJobTargets grava os IDs de usuários resolvidos, em ordem, para que os
+// retries dividam os mesmos alunos nos mesmos batches. Não sobrescreve uma lista já gravada.
+func SaveJobTargets(ctx context.Context, db *sql.DB, jobID string, userIDs []string) error {
+	data, err := json.Marshal(userIDs)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx,
+		`UPDATE export_jobs SET target_user_ids = ? WHERE id = ? AND target_user_ids IS NULL`,
+		string(data), jobID,
+	)
+	return err
+}
+
+// IsCancelRequested informa se foi pedido o cancelamento do job
+func IsCancelRequested(ctx context.Context, db *sql.DB, jobID string) (bool, error) {
+	var requested bool
+	err := db.QueryRowContext(ctx,
+		`SELECT cancel_requested_at IS NOT NULL FROM export_jobs WHERE id = ?`, jobID,
+	).Scan(&requested)
+	return requested, err
+}
+
+// deadLetterCondition identifica jobs que esgotaram as tentativas
+const deadLetterCondition = `status = 'FAILED' AND retry_count >= max_retries`
+
+// GetDeadLetterJobs busca jobs que falharam permanentemente, mais recentes primeiro
+func GetDeadLetterJobs(ctx context.Context, db *sql.DB, jobType string, limit int) ([]models.Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM export_jobs WHERE ` + deadLetterCondition
+	args := []interface{}{}
+
+	if jobType != "" {
+		query += ` AND type = ?`
+		args = append(args, jobType)
+	}
+
+	query += ` ORDER BY completed_at DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []models.Job{}
+	for rows.Next() {
+		job, err := models.ScanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *job)
+	}
+
+	return jobs, rows.Err()
+}
+
+// CountScheduledJobs conta jobs pendentes agendados para o futuro (run_at)
+func CountScheduledJobs(ctx context.Context, db *sql.DB) (int, error) {
+	var count int
+	err := db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM export_jobs WHERE status = 'PENDING' AND run_at > ?`, FormatTime(time.Now()),
+	).Scan(&count)
+	return count, err
+}
+
+// CountDeadLetterJobs conta os jobs que falharam permanentemente
+func CountDeadLetterJobs(ctx context.Context, db *sql.DB) (int, error) {
+	var count int
+	err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM export_jobs WHERE `+deadLetterCondition).Scan(&count)
+	return count, err
+}
+
+// RequeueDeadLetterJobs devolve jobs da dead-letter à fila com as tentativas zeradas.
+// Batches já enviados são mantidos, então o job continua de onde parou.
+func RequeueDeadLetterJobs(ctx context.Context, db *sql.DB, jobIDs []string) ([]string, error) {
+	return updateDeadLetterJobs(ctx, db, jobIDs, `
+		status = 'PENDING',
+		retry_count = 0,
+		last_retry_at = NULL,
+		next_attempt_at = NULL,
+		completed_at = NULL,
+		error_message = NULL
+	`)
+}
+
+// DiscardDeadLetterJobs marca jobs da dead-letter como DISCARDED
+func DiscardDeadLetterJobs(ctx context.Context, db *sql.DB, jobIDs []string) ([]string, error) {
+	return updateDeadLetterJobs(ctx, db, jobIDs, `status = 'DISCARDED'`)
+}
+
+// updateDeadLetterJobs aplica set aos jobs da lista que ainda estão na dead-letter
+// e retorna os IDs efetivamente alterados
+func updateDeadLetterJobs(ctx context.Context, db *sql.DB, jobIDs []string, set string) ([]string, error) {
+	updated := []string{}
+
+	for _, jobID := range jobIDs {
+		res, err := db.ExecContext(ctx, `UPDATE export_jobs SET `+set+` WHERE id = ? AND `+deadLetterCondition, jobID)
+		if err != nil {
+			return updated, err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return updated, err
+		}
+		if n == 1 {
+			updated = append(updated, jobID)
+		}
+	}
+
+	return updated, nil
+}
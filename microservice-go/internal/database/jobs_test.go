@@ -0,0 +1,449 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// openJobsDB abre um banco local vazio com o schema do worker
+func openJobsDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("libsql", "file:"+filepath.Join(t.TempDir(), "jobs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := InitSchema(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// insertJob cria um job PENDING e aplica set (ex: "status = 'PROCESSING'") logo em seguida
+func insertJob(t *testing.T, db *sql.DB, jobID, set string, args ...interface{}) {
+	t.Helper()
+
+	_, err := db.Exec(`INSERT INTO export_jobs (id, type, payload) VALUES (?, 'MANUAL', '{}')`, jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set == "" {
+		return
+	}
+	if _, err := db.Exec(`UPDATE export_jobs SET `+set+` WHERE id = ?`, append(args, jobID)...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClaimJobConcurrent(t *testing.T) {
+	ctx := context.Background()
+	db := openJobsDB(t)
+	// Arquivo local não aceita escritas concorrentes; no Turso o primário as serializa
+	db.SetMaxOpenConns(1)
+
+	insertJob(t, db, "job_1", "")
+
+	const workers = 8
+	leaseUntil := time.Now().Add(time.Minute)
+
+	var mu sync.Mutex
+	var winners []string
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		owner := fmt.Sprintf("worker-%d", i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			claimed, err := ClaimJob(ctx, db, "job_1", owner, leaseUntil)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if claimed {
+				mu.Lock()
+				winners = append(winners, owner)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(winners) != 1 {
+		t.Fatalf("vencedores = %v, esperado exatamente 1", winners)
+	}
+
+	job, err := GetJob(ctx, db, "job_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != "PROCESSING" || job.LeaseOwner == nil || *job.LeaseOwner != winners[0] {
+		t.Errorf("status = %s, lease_owner = %v; esperado PROCESSING de %s", job.Status, job.LeaseOwner, winners[0])
+	}
+}
+
+func TestClaimJob(t *testing.T) {
+	past := FormatTime(time.Now().Add(-time.Hour))
+
+	tests := []struct {
+		name string
+		set  string
+		args []interface{}
+		want bool
+	}{
+		{"pendente", "", nil, true},
+		{"falhou com tentativas restantes", "status = 'FAILED', retry_count = 1", nil, true},
+		{"falhou sem tentativas restantes", "status = 'FAILED', retry_count = 3", nil, false},
+		{"já em processamento", "status = 'PROCESSING', lease_owner = 'worker-a', lease_expires_at = ?", []interface{}{past}, false},
+		{"concluído", "status = 'COMPLETED'", nil, false},
+		{"cancelado", "status = 'CANCELLED'", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			db := openJobsDB(t)
+			insertJob(t, db, "job_1", tt.set, tt.args...)
+
+			claimed, err := ClaimJob(ctx, db, "job_1", "worker-b", time.Now().Add(time.Minute))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claimed != tt.want {
+				t.Errorf("ClaimJob = %v, esperado %v", claimed, tt.want)
+			}
+		})
+	}
+}
+
+func TestLeaseOwnership(t *testing.T) {
+	ctx := context.Background()
+	db := openJobsDB(t)
+	insertJob(t, db, "job_1", "")
+
+	if claimed, err := ClaimJob(ctx, db, "job_1", "worker-a", time.Now().Add(time.Minute)); err != nil || !claimed {
+		t.Fatalf("ClaimJob = %v, %v", claimed, err)
+	}
+
+	tests := []struct {
+		owner string
+		want  bool
+	}{
+		{"worker-a", true},
+		{"worker-b", false},
+	}
+	for _, tt := range tests {
+		renewed, err := RenewLease(ctx, db, "job_1", tt.owner, time.Now().Add(2*time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if renewed != tt.want {
+			t.Errorf("RenewLease(%s) = %v, esperado %v", tt.owner, renewed, tt.want)
+		}
+	}
+
+	// Só o dono grava o status final
+	if err := FinishJob(ctx, db, "job_1", "worker-b", "COMPLETED", nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	if job, _ := GetJob(ctx, db, "job_1"); job.Status != "PROCESSING" {
+		t.Fatalf("status após FinishJob de outro worker = %s, esperado PROCESSING", job.Status)
+	}
+
+	if err := FinishJob(ctx, db, "job_1", "worker-a", "COMPLETED", map[string]interface{}{"sent": 1}, ""); err != nil {
+		t.Fatal(err)
+	}
+	job, err := GetJob(ctx, db, "job_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != "COMPLETED" || job.LeaseOwner != nil || job.LeaseExpiresAt != nil || job.CompletedAt == nil {
+		t.Errorf("job = %+v, esperado COMPLETED sem lease", job)
+	}
+
+	// Lease liberado: nem o antigo dono renova
+	if renewed, _ := RenewLease(ctx, db, "job_1", "worker-a", time.Now().Add(time.Minute)); renewed {
+		t.Error("RenewLease renovou um job concluído")
+	}
+}
+
+func TestRecoverJobStaleLease(t *testing.T) {
+	ctx := context.Background()
+	db := openJobsDB(t)
+
+	expired := FormatTime(time.Now().Add(-time.Minute))
+	insertJob(t, db, "job_1", "status = 'PROCESSING', lease_owner = 'worker-a', lease_expires_at = ?", expired)
+
+	stale, err := GetJob(ctx, db, "job_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// O dono renovou o lease depois que o reaper leu o job
+	if renewed, err := RenewLease(ctx, db, "job_1", "worker-a", time.Now().Add(time.Minute)); err != nil || !renewed {
+		t.Fatalf("RenewLease = %v, %v", renewed, err)
+	}
+	recovered, err := RecoverJob(ctx, db, *stale, "PENDING", 1, time.Now(), "lease expirado")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recovered {
+		t.Fatal("RecoverJob recuperou um job com lease renovado")
+	}
+
+	// Leitura atual do lease: a recuperação acontece uma única vez
+	current, err := GetJob(ctx, db, "job_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []bool{true, false} {
+		recovered, err := RecoverJob(ctx, db, *current, "PENDING", 1, time.Now(), "lease expirado")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if recovered != want {
+			t.Errorf("tentativa %d: RecoverJob = %v, esperado %v", i+1, recovered, want)
+		}
+	}
+}
+
+// assertRunnable verifica se job_1 aparece em GetPendingJobs e pode ser reivindicado
+func assertRunnable(t *testing.T, db *sql.DB, want bool) {
+	t.Helper()
+	ctx := context.Background()
+
+	jobs, err := GetPendingJobs(ctx, db, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending := len(jobs) == 1 && jobs[0].ID == "job_1"; pending != want {
+		t.Errorf("GetPendingJobs = %d jobs, esperado job_1 pendente = %v", len(jobs), want)
+	}
+
+	claimed, err := ClaimJob(ctx, db, "job_1", "worker-a", time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claimed != want {
+		t.Errorf("ClaimJob = %v, esperado %v", claimed, want)
+	}
+}
+
+func TestRequeueJobBackoff(t *testing.T) {
+	tests := []struct {
+		name          string
+		nextAttemptAt time.Time
+		want          bool
+	}{
+		{"próxima tentativa no futuro", time.Now().Add(time.Hour), false},
+		{"próxima tentativa no passado", time.Now().Add(-time.Second), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			db := openJobsDB(t)
+			insertJob(t, db, "job_1", "")
+
+			if claimed, err := ClaimJob(ctx, db, "job_1", "worker-a", time.Now().Add(time.Minute)); err != nil || !claimed {
+				t.Fatalf("ClaimJob = %v, %v", claimed, err)
+			}
+			if err := RequeueJob(ctx, db, "job_1", "worker-a", 1, tt.nextAttemptAt, "falha temporária"); err != nil {
+				t.Fatal(err)
+			}
+
+			job, err := GetJob(ctx, db, "job_1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if job.Status != "PENDING" || job.RetryCount != 1 || job.LeaseOwner != nil {
+				t.Fatalf("status = %s, retry_count = %d, lease_owner = %v; esperado PENDING, 1, sem lease",
+					job.Status, job.RetryCount, job.LeaseOwner)
+			}
+
+			assertRunnable(t, db, tt.want)
+		})
+	}
+}
+
+func TestCancelJob(t *testing.T) {
+	tests := []struct {
+		name          string
+		set           string
+		wantPending   bool // CancelPendingJob cancela
+		wantRequested bool // RequestJobCancel marca
+		wantStatus    string
+	}{
+		{"pendente", "", true, false, "CANCELLED"},
+		{"aguardando retry", "status = 'FAILED', retry_count = 1", true, false, "CANCELLED"},
+		{"em processamento", "status = 'PROCESSING', lease_owner = 'worker-a'", false, true, "PROCESSING"},
+		{"falhou sem tentativas restantes", "status = 'FAILED', retry_count = 3", false, false, "FAILED"},
+		{"concluído", "status = 'COMPLETED'", false, false, "COMPLETED"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			db := openJobsDB(t)
+			insertJob(t, db, "job_1", tt.set)
+
+			cancelled, err := CancelPendingJob(ctx, db, "job_1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cancelled != tt.wantPending {
+				t.Errorf("CancelPendingJob = %v, esperado %v", cancelled, tt.wantPending)
+			}
+
+			requested, err := RequestJobCancel(ctx, db, "job_1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if requested != tt.wantRequested {
+				t.Errorf("RequestJobCancel = %v, esperado %v", requested, tt.wantRequested)
+			}
+
+			marked, err := IsCancelRequested(ctx, db, "job_1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if marked != tt.wantRequested {
+				t.Errorf("IsCancelRequested = %v, esperado %v", marked, tt.wantRequested)
+			}
+
+			job, err := GetJob(ctx, db, "job_1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if job.Status != tt.wantStatus {
+				t.Errorf("status = %s, esperado %s", job.Status, tt.wantStatus)
+			}
+			if tt.wantPending && (job.CompletedAt == nil || job.NextAttemptAt != nil) {
+				t.Errorf("completed_at = %v, next_attempt_at = %v após cancelar", job.CompletedAt, job.NextAttemptAt)
+			}
+		})
+	}
+}
+
+func TestRequestJobCancelKeepsFirstRequest(t *testing.T) {
+	ctx := context.Background()
+	db := openJobsDB(t)
+
+	first := FormatTime(time.Now().Add(-time.Hour))
+	insertJob(t, db, "job_1", "status = 'PROCESSING', cancel_requested_at = ?", first)
+
+	if requested, err := RequestJobCancel(ctx, db, "job_1"); err != nil || !requested {
+		t.Fatalf("RequestJobCancel = %v, %v", requested, err)
+	}
+
+	job, err := GetJob(ctx, db, "job_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.CancelRequestedAt == nil || FormatTime(*job.CancelRequestedAt) != first {
+		t.Errorf("cancel_requested_at = %v, esperado %s", job.CancelRequestedAt, first)
+	}
+}
+
+func TestScheduledJobRunAt(t *testing.T) {
+	tests := []struct {
+		name          string
+		runAt         interface{}
+		want          bool
+		wantScheduled int
+	}{
+		{"agendado para o futuro", FormatTime(time.Now().Add(time.Hour)), false, 1},
+		{"agendado no passado", FormatTime(time.Now().Add(-time.Second)), true, 0},
+		{"sem agendamento", nil, true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openJobsDB(t)
+			insertJob(t, db, "job_1", "run_at = ?", tt.runAt)
+
+			scheduled, err := CountScheduledJobs(context.Background(), db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if scheduled != tt.wantScheduled {
+				t.Errorf("CountScheduledJobs = %d, esperado %d", scheduled, tt.wantScheduled)
+			}
+
+			assertRunnable(t, db, tt.want)
+		})
+	}
+}
+
+func TestListJobsKeysetPages(t *testing.T) {
+	ctx := context.Background()
+	db := openJobsDB(t)
+
+	// Empates de created_at e priority nas bordas das páginas de 3
+	base := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	seed := []struct {
+		id       string
+		priority int
+		age      time.Duration
+	}{
+		{"job_a", 0, 0},
+		{"job_b", 1, 0},
+		{"job_c", 0, 0},
+		{"job_d", 1, time.Second},
+		{"job_e", 0, time.Second},
+		{"job_f", 1, 2 * time.Second},
+		{"job_g", 0, 2 * time.Second},
+	}
+	for _, s := range seed {
+		insertJob(t, db, s.id, "priority = ?, created_at = ?", s.priority, FormatTime(base.Add(-s.age)))
+	}
+
+	tests := []struct {
+		sort      string
+		ascending bool
+		want      []string
+	}{
+		{JobSortCreatedAt, false, []string{"job_c", "job_b", "job_a", "job_e", "job_d", "job_g", "job_f"}},
+		{JobSortCreatedAt, true, []string{"job_f", "job_g", "job_d", "job_e", "job_a", "job_b", "job_c"}},
+		{JobSortPriority, false, []string{"job_b", "job_d", "job_f", "job_c", "job_a", "job_e", "job_g"}},
+		{JobSortPriority, true, []string{"job_g", "job_e", "job_a", "job_c", "job_f", "job_d", "job_b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s asc=%v", tt.sort, tt.ascending), func(t *testing.T) {
+			var got []string
+			var pages int
+			filter := JobFilter{Sort: tt.sort, Ascending: tt.ascending, Limit: 3}
+
+			for {
+				jobs, err := ListJobs(ctx, db, filter)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(jobs) == 0 {
+					break
+				}
+				pages++
+				for _, job := range jobs {
+					got = append(got, job.ID)
+				}
+				cursor := CursorFor(jobs[len(jobs)-1])
+				filter.After = &cursor
+			}
+
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("ordem = %v, esperado %v", got, tt.want)
+			}
+			if pages != 3 {
+				t.Errorf("%d páginas, esperado 3", pages)
+			}
+		})
+	}
+}
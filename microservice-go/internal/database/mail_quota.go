@@ -0,0 +1,73 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ReserveMailQuota reserva até n envios no uso do dia sem passar de limit e
+// retorna quantos reservou (0 = cota esgotada). Conferência e incremento são um
+// único UPDATE, então réplicas concorrentes nunca reservam além do limite; se
+// outra réplica reservar entre a leitura do uso e o UPDATE, tenta de novo.
+func ReserveMailQuota(ctx context.Context, db *sql.DB, day string, n, limit int) (int, error) {
+	_, err := db.ExecContext(ctx,
+		`INSERT INTO mail_quota (day, sent) VALUES (?, 0) ON CONFLICT(day) DO NOTHING`, day,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		sent, err := GetMailQuotaUsage(ctx, db, day)
+		if err != nil {
+			return 0, err
+		}
+
+		want := min(n, limit-sent)
+		if want <= 0 {
+			return 0, nil
+		}
+
+		res, err := db.ExecContext(ctx, `
+			UPDATE mail_quota
+			SET sent = sent + ?, updated_at = ?
+			WHERE day = ? AND sent + ? <= ?
+		`, want, FormatTime(time.Now()), day, want, limit)
+		if err != nil {
+			return 0, err
+		}
+
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		if rows == 1 {
+			return want, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// ReleaseMailQuota devolve ao dia n envios reservados e não usados
+func ReleaseMailQuota(ctx context.Context, db *sql.DB, day string, n int) error {
+	_, err := db.ExecContext(ctx, `
+		UPDATE mail_quota
+		SET sent = MAX(sent - ?, 0), updated_at = ?
+		WHERE day = ?
+	`, n, FormatTime(time.Now()), day)
+	return err
+}
+
+// GetMailQuotaUsage retorna quantos envios foram reservados no dia
+func GetMailQuotaUsage(ctx context.Context, db *sql.DB, day string) (int, error) {
+	var sent int
+	err := db.QueryRowContext(ctx, `SELECT sent FROM mail_quota WHERE day = ?`, day).Scan(&sent)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return sent, err
+}
@@ -29,10 +29,30 @@ func InitSchema(db *sql.DB) error {
 		return fmt.Errorf("failed to create export_jobs table: %w", err)
 	}
 
+	// Colunas adicionadas após a criação da tabela
+	jobColumns := []columnDef{
+		{Name: "lease_owner", Definition: "TEXT"},
+		{Name: "lease_expires_at", Definition: "DATETIME"},
+		{Name: "next_attempt_at", Definition: "DATETIME"},
+		{Name: "cancel_requested_at", Definition: "DATETIME"},
+		{Name: "idempotency_key", Definition: "TEXT"},
+		{Name: "run_at", Definition: "DATETIME"},
+		{Name: "target_user_ids", Definition: "TEXT"},
+	}
+
+	for _, col := range jobColumns {
+		if err := addColumnIfMissing(db, "export_jobs", col); err != nil {
+			return fmt.Errorf("failed to add export_jobs.%s column: %w", col.Name, err)
+		}
+	}
+
 	// Índices para jobs
 	jobIndexes := []string{
 		"CREATE INDEX IF NOT EXISTS idx_export_jobs_status ON export_jobs(status);",
 		"CREATE INDEX IF NOT EXISTS idx_export_jobs_priority ON export_jobs(priority DESC, created_at);",
+		"CREATE INDEX IF NOT EXISTS idx_export_jobs_next_attempt ON export_jobs(status, next_attempt_at);",
+		"CREATE INDEX IF NOT EXISTS idx_export_jobs_run_at ON export_jobs(status, run_at);",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_export_jobs_idempotency_key ON export_jobs(idempotency_key);",
 	}
 
 	for _, idx := range jobIndexes {
@@ -62,6 +82,18 @@ func InitSchema(db *sql.DB) error {
 		return fmt.Errorf("failed to create export_batches table: %w", err)
 	}
 
+	// Colunas adicionadas após a criação da tabela
+	batchColumns := []columnDef{
+		{Name: "sent_user_ids", Definition: "TEXT"},
+		{Name: "failed_user_ids", Definition: "TEXT"},
+	}
+
+	for _, col := range batchColumns {
+		if err := addColumnIfMissing(db, "export_batches", col); err != nil {
+			return fmt.Errorf("failed to add export_batches.%s column: %w", col.Name, err)
+		}
+	}
+
 	// Índices para batches
 	batchIndexes := []string{
 		"CREATE INDEX IF NOT EXISTS idx_export_batches_job_id ON export_batches(job_id);",
@@ -73,6 +105,75 @@ func InitSchema(db *sql.DB) error {
 		}
 	}
 
+	// Agendamentos recorrentes de exportação
+	scheduleTableSQL := `
+	CREATE TABLE IF NOT EXISTS export_schedules (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		cron TEXT NOT NULL,
+		target_type TEXT NOT NULL,
+		target_ids TEXT,
+		period TEXT NOT NULL,
+		delivery_mode TEXT NOT NULL DEFAULT 'RECIPIENT',
+		to_email TEXT,
+		enabled BOOLEAN NOT NULL DEFAULT 1,
+		version INTEGER NOT NULL DEFAULT 1,
+		last_run_at DATETIME,
+		last_job_id TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	if _, err := db.Exec(scheduleTableSQL); err != nil {
+		return fmt.Errorf("failed to create export_schedules table: %w", err)
+	}
+
+	// Cota diária de envios de email, compartilhada pelas réplicas
+	mailQuotaTableSQL := `
+	CREATE TABLE IF NOT EXISTS mail_quota (
+		day TEXT PRIMARY KEY,
+		sent INTEGER NOT NULL DEFAULT 0,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	if _, err := db.Exec(mailQuotaTableSQL); err != nil {
+		return fmt.Errorf("failed to create mail_quota table: %w", err)
+	}
+
 	fmt.Println("Database schema initialized successfully")
 	return nil
 }
+
+// columnDef descreve uma coluna adicionada por migração
+type columnDef struct {
+	Name       string
+	Definition string
+}
+
+// addColumnIfMissing adiciona uma coluna à tabela caso ainda não exista
+func addColumnIfMissing(db *sql.DB, table string, col columnDef) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return err
+		}
+		if name == col.Name {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, col.Name, col.Definition))
+	return err
+}
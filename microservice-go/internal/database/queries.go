@@ -27,27 +27,10 @@ func GetUsers(ctx context.Context, db *sql.DB, userIDs []string) ([]models.User,
 		FROM users u
 		LEFT JOIN turmas t ON u.turmaId = t.id
 		WHERE u.id IN (%s)
+		ORDER BY u.id
 	`, strings.Join(placeholders, ","))
 
-	rows, err := db.QueryContext(ctx, query, args...)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var users []models.User
-	for rows.Next() {
-		var u models.User
-		err := rows.Scan(
-			&u.ID, &u.Email, &u.Name, &u.Role, &u.TurmaID, &u.TurmaName, &u.AutoExportConsent, &u.CreatedAt, &u.UpdatedAt,
-		)
-		if err != nil {
-			return nil, err
-		}
-		users = append(users, u)
-	}
-
-	return users, nil
+	return queryUsers(ctx, db, query, args...)
 }
 
 // GetTransactions fetches transactions for specific users within a date range
@@ -110,10 +93,49 @@ func GetConsentingStudents(ctx context.Context, db *sql.DB) ([]models.User, erro
 		FROM users u
 		LEFT JOIN turmas t ON u.turmaId = t.id
 		WHERE u.role = 'STUDENT' AND u.autoExportConsent = 1
+		ORDER BY u.id
 	`
 	// Note: Boolean in SQLite is usually 0/1
 
-	rows, err := db.QueryContext(ctx, query)
+	return queryUsers(ctx, db, query)
+}
+
+// GetStudentsByTurmas fetches all students enrolled in the given turmas, matched by ID or name
+func GetStudentsByTurmas(ctx context.Context, db *sql.DB, turmaIDs, turmaNames []string) ([]models.User, error) {
+	if len(turmaIDs) == 0 && len(turmaNames) == 0 {
+		return []models.User{}, nil
+	}
+
+	conditions := make([]string, 0, 2)
+	args := make([]interface{}, 0, len(turmaIDs)+len(turmaNames))
+
+	if len(turmaIDs) > 0 {
+		conditions = append(conditions, fmt.Sprintf("u.turmaId IN (%s)", sqlPlaceholders(len(turmaIDs))))
+		for _, id := range turmaIDs {
+			args = append(args, id)
+		}
+	}
+	if len(turmaNames) > 0 {
+		conditions = append(conditions, fmt.Sprintf("t.name IN (%s)", sqlPlaceholders(len(turmaNames))))
+		for _, name := range turmaNames {
+			args = append(args, name)
+		}
+	}
+
+	query := fmt.Sprintf(`
+		SELECT u.id, u.email, u.name, u.role, u.turmaId, t.name, u.autoExportConsent, u.createdAt, u.updatedAt
+		FROM users u
+		INNER JOIN turmas t ON u.turmaId = t.id
+		WHERE u.role = 'STUDENT' AND (%s)
+		ORDER BY u.id
+	`, strings.Join(conditions, " OR "))
+
+	return queryUsers(ctx, db, query, args...)
+}
+
+// queryUsers executes a user query and scans the rows
+func queryUsers(ctx context.Context, db *sql.DB, query string, args ...interface{}) ([]models.User, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -131,5 +153,10 @@ func GetConsentingStudents(ctx context.Context, db *sql.DB) ([]models.User, erro
 		users = append(users, u)
 	}
 
-	return users, nil
+	return users, rows.Err()
+}
+
+// sqlPlaceholders returns n comma-separated "?" placeholders
+func sqlPlaceholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
 }
@@ -0,0 +1,121 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// purgeableCondition seleciona jobs finalizados há mais tempo que o corte.
+// FAILED só entra quando esgotou as tentativas (jobs aguardando retry são mantidos).
+const purgeableCondition = `(status IN ('COMPLETED', 'CANCELLED', 'DISCARDED')
+		    OR (status = 'FAILED' AND retry_count >= max_retries))
+		  AND COALESCE(completed_at, created_at) < ?`
+
+// PurgeReport resume os jobs e batches removidos (ou que seriam removidos)
+type PurgeReport struct {
+	Cutoff   time.Time      `json:"cutoff"`
+	Jobs     int            `json:"jobs"`
+	Batches  int            `json:"batches"`
+	ByStatus map[string]int `json:"by_status"`
+}
+
+// GetPurgeReport conta o que PurgeJobs removeria com o mesmo corte (dry-run)
+func GetPurgeReport(ctx context.Context, db *sql.DB, cutoff time.Time) (*PurgeReport, error) {
+	report := &PurgeReport{Cutoff: cutoff, ByStatus: make(map[string]int)}
+
+	rows, err := db.QueryContext(ctx,
+		`SELECT status, COUNT(*) FROM export_jobs WHERE `+purgeableCondition+` GROUP BY status`,
+		FormatTime(cutoff),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, err
+		}
+		report.ByStatus[status] = count
+		report.Jobs += count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM export_batches WHERE job_id IN (SELECT id FROM export_jobs WHERE `+purgeableCondition+`)`,
+		FormatTime(cutoff),
+	).Scan(&report.Batches)
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// PurgeJobs remove jobs finalizados antes do corte e seus batches.
+// Os batches são apagados explicitamente, sem depender de foreign_keys no SQLite.
+func PurgeJobs(ctx context.Context, db *sql.DB, cutoff time.Time) (*PurgeReport, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	report := &PurgeReport{Cutoff: cutoff, ByStatus: make(map[string]int)}
+
+	res, err := tx.ExecContext(ctx,
+		`DELETE FROM export_batches WHERE job_id IN (SELECT id FROM export_jobs WHERE `+purgeableCondition+`)`,
+		FormatTime(cutoff),
+	)
+	if err != nil {
+		return nil, err
+	}
+	batches, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	report.Batches = int(batches)
+
+	// Contagem por status antes de apagar, para o log
+	rows, err := tx.QueryContext(ctx,
+		`SELECT status, COUNT(*) FROM export_jobs WHERE `+purgeableCondition+` GROUP BY status`,
+		FormatTime(cutoff),
+	)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		report.ByStatus[status] = count
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	res, err = tx.ExecContext(ctx, `DELETE FROM export_jobs WHERE `+purgeableCondition, FormatTime(cutoff))
+	if err != nil {
+		return nil, err
+	}
+	jobs, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	report.Jobs = int(jobs)
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
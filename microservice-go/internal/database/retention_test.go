@@ -0,0 +1,95 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPurgeJobs(t *testing.T) {
+	ctx := context.Background()
+	db := openJobsDB(t)
+
+	cutoff := time.Now().AddDate(0, 0, -30)
+	old := FormatTime(cutoff.Add(-time.Hour))
+	recent := FormatTime(cutoff.Add(time.Hour))
+
+	seed := []struct {
+		id        string
+		set       string
+		args      []interface{}
+		batches   int
+		wantPurge bool
+	}{
+		{"job_concluido_antigo", "status = 'COMPLETED', completed_at = ?", []interface{}{old}, 2, true},
+		{"job_cancelado_antigo", "status = 'CANCELLED', completed_at = ?", []interface{}{old}, 0, true},
+		{"job_descartado_antigo", "status = 'DISCARDED', completed_at = ?", []interface{}{old}, 1, true},
+		{"job_falhou_antigo", "status = 'FAILED', retry_count = 3, completed_at = ?", []interface{}{old}, 1, true},
+		{"job_aguardando_retry", "status = 'FAILED', retry_count = 1, completed_at = ?", []interface{}{old}, 1, false},
+		{"job_concluido_recente", "status = 'COMPLETED', completed_at = ?", []interface{}{recent}, 1, false},
+		{"job_pendente_antigo", "created_at = ?", []interface{}{old}, 0, false},
+		{"job_processando_antigo", "status = 'PROCESSING', created_at = ?", []interface{}{old}, 1, false},
+		{"job_cancelado_sem_completed_at", "status = 'CANCELLED', created_at = ?", []interface{}{old}, 0, true},
+	}
+
+	wantJobs, wantBatches := 0, 0
+	for _, s := range seed {
+		insertJob(t, db, s.id, s.set, s.args...)
+		for i := 1; i <= s.batches; i++ {
+			_, err := db.Exec(
+				`INSERT INTO export_batches (id, job_id, batch_number, total_batches, recipients_count) VALUES (?, ?, ?, ?, 1)`,
+				fmt.Sprintf("%s_batch_%d", s.id, i), s.id, i, s.batches,
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if s.wantPurge {
+			wantJobs++
+			wantBatches += s.batches
+		}
+	}
+	wantByStatus := map[string]int{"COMPLETED": 1, "CANCELLED": 2, "DISCARDED": 1, "FAILED": 1}
+
+	// O dry-run conta o mesmo que a limpeza remove, sem apagar nada
+	dryRun, err := GetPurgeReport(ctx, db, cutoff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := PurgeJobs(ctx, db, cutoff)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, r := range map[string]*PurgeReport{"GetPurgeReport": dryRun, "PurgeJobs": report} {
+		if r.Jobs != wantJobs || r.Batches != wantBatches || fmt.Sprint(r.ByStatus) != fmt.Sprint(wantByStatus) {
+			t.Errorf("%s = %d jobs, %d batches, %v; esperado %d, %d, %v",
+				name, r.Jobs, r.Batches, r.ByStatus, wantJobs, wantBatches, wantByStatus)
+		}
+	}
+
+	for _, s := range seed {
+		_, err := GetJob(ctx, db, s.id)
+		if exists := err == nil; exists == s.wantPurge {
+			t.Errorf("%s: existe = %v após a limpeza (err %v)", s.id, exists, err)
+		}
+
+		batches, err := GetJobBatches(ctx, db, s.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantBatches := s.batches
+		if s.wantPurge {
+			wantBatches = 0
+		}
+		if len(batches) != wantBatches {
+			t.Errorf("%s: %d batches após a limpeza, esperado %d", s.id, len(batches), wantBatches)
+		}
+	}
+
+	// Nada mais a remover com o mesmo corte
+	if again, err := PurgeJobs(ctx, db, cutoff); err != nil || again.Jobs != 0 || again.Batches != 0 {
+		t.Errorf("segunda limpeza = %+v, %v; esperado nada removido", again, err)
+	}
+}
@@ -0,0 +1,139 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"educasa/internal/models"
+)
+
+// scheduleColumns lista as colunas na ordem esperada por models.ScanSchedule
+const scheduleColumns = `id, name, cron, target_type, target_ids, period, delivery_mode, to_email,
+		       enabled, version, last_run_at, last_job_id, created_at, updated_at`
+
+// ListSchedules busca todos os agendamentos de exportação
+func ListSchedules(ctx context.Context, db *sql.DB) ([]models.ExportSchedule, error) {
+	rows, err := db.QueryContext(ctx, `SELECT `+scheduleColumns+` FROM export_schedules ORDER BY created_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schedules := []models.ExportSchedule{}
+	for rows.Next() {
+		s, err := models.ScanSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, *s)
+	}
+
+	return schedules, rows.Err()
+}
+
+// GetSchedule busca um agendamento pelo ID.
+// Retorna sql.ErrNoRows se o agendamento não existir.
+func GetSchedule(ctx context.Context, db *sql.DB, id string) (*models.ExportSchedule, error) {
+	rows, err := db.QueryContext(ctx, `SELECT `+scheduleColumns+` FROM export_schedules WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, sql.ErrNoRows
+	}
+
+	return models.ScanSchedule(rows)
+}
+
+// CreateSchedule grava um novo agendamento, preenchendo s.ID
+func CreateSchedule(ctx context.Context, db *sql.DB, s *models.ExportSchedule) error {
+	targetIDs, err := json.Marshal(s.TargetIDs)
+	if err != nil {
+		return err
+	}
+
+	s.ID = fmt.Sprintf("sched_%d", time.Now().UnixNano())
+
+	query := `
+		INSERT INTO export_schedules (id, name, cron, target_type, target_ids, period, delivery_mode, to_email, enabled)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err = db.ExecContext(ctx, query,
+		s.ID, s.Name, s.Cron, s.TargetType, string(targetIDs), s.Period, s.DeliveryMode, nullString(s.ToEmail), s.Enabled,
+	)
+	return err
+}
+
+// UpdateSchedule substitui os campos editáveis de um agendamento e incrementa a versão.
+// Retorna false se o agendamento não existir.
+func UpdateSchedule(ctx context.Context, db *sql.DB, s *models.ExportSchedule) (bool, error) {
+	targetIDs, err := json.Marshal(s.TargetIDs)
+	if err != nil {
+		return false, err
+	}
+
+	query := `
+		UPDATE export_schedules
+		SET name = ?,
+		    cron = ?,
+		    target_type = ?,
+		    target_ids = ?,
+		    period = ?,
+		    delivery_mode = ?,
+		    to_email = ?,
+		    enabled = ?,
+		    version = version + 1,
+		    updated_at = ?
+		WHERE id = ?
+	`
+
+	res, err := db.ExecContext(ctx, query,
+		s.Name, s.Cron, s.TargetType, string(targetIDs), s.Period, s.DeliveryMode, nullString(s.ToEmail), s.Enabled,
+		FormatTime(time.Now()), s.ID,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// DeleteSchedule remove um agendamento. Jobs já criados por ele não são afetados.
+// Retorna false se o agendamento não existir.
+func DeleteSchedule(ctx context.Context, db *sql.DB, id string) (bool, error) {
+	res, err := db.ExecContext(ctx, `DELETE FROM export_schedules WHERE id = ?`, id)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// MarkScheduleRun registra o último disparo do agendamento (sem alterar a versão)
+func MarkScheduleRun(ctx context.Context, db *sql.DB, id string, runAt time.Time, jobID string) error {
+	query := `
+		UPDATE export_schedules
+		SET last_run_at = ?, last_job_id = ?
+		WHERE id = ?
+	`
+
+	_, err := db.ExecContext(ctx, query, FormatTime(runAt), jobID, id)
+	return err
+}
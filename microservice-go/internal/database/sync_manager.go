@@ -99,30 +99,30 @@ func (sm *SyncManager) GetStatus() SyncStatus {
 	}
 
 	return SyncStatus{
-		Enabled:    true,
-		LastSync:   sm.lastSync,
-		SyncCount:  sm.syncCount,
-		Interval:   sm.syncInterval,
-		NextSync:   sm.lastSync.Add(sm.syncInterval),
+		Enabled:   true,
+		LastSync:  sm.lastSync,
+		SyncCount: sm.syncCount,
+		Interval:  sm.syncInterval,
+		NextSync:  sm.lastSync.Add(sm.syncInterval),
 	}
 }
 
 // SyncStatus representa o status do sync
 type SyncStatus struct {
-	Enabled   bool           `json:"enabled"`
-	LastSync  time.Time      `json:"last_sync"`
-	SyncCount int64          `json:"sync_count"`
-	Interval  time.Duration  `json:"interval"`
-	NextSync  time.Time      `json:"next_sync"`
+	Enabled   bool          `json:"enabled"`
+	LastSync  time.Time     `json:"last_sync"`
+	SyncCount int64         `json:"sync_count"`
+	Interval  time.Duration `json:"interval"`
+	NextSync  time.Time     `json:"next_sync"`
 }
 
 // SyncResult representa o resultado de um sync
 type SyncResult struct {
-	Status       string         `json:"status"`
-	Timestamp    time.Time      `json:"timestamp"`
-	FramesSynced int            `json:"frames_synced"`
-	FrameNo      int            `json:"frame_no"`
-	Duration     time.Duration  `json:"duration_ms"`
+	Status       string        `json:"status"`
+	Timestamp    time.Time     `json:"timestamp"`
+	FramesSynced int           `json:"frames_synced"`
+	FrameNo      int           `json:"frame_no"`
+	Duration     time.Duration `json:"duration_ms"`
 }
 
 // SyncWithResult executa um sync e retorna detalhes
@@ -12,9 +12,9 @@ import (
 
 // Config holds database configuration
 type Config struct {
-	Mode           string        // "cloud" ou "embedded"
-	LocalPath      string        // Caminho do arquivo local
-	RemoteURL      string        // URL do Turso Cloud
+	Mode           string // "cloud" ou "embedded"
+	LocalPath      string // Caminho do arquivo local
+	RemoteURL      string // URL do Turso Cloud
 	AuthToken      string
 	SyncInterval   time.Duration // Intervalo de sync automático
 	EncryptionKey  string        // Opcional
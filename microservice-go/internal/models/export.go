@@ -1,16 +1,71 @@
 package models
 
+import (
+	"database/sql"
+	"encoding/json"
+)
+
 // Batch representa um batch de exportação
 type Batch struct {
-	ID             string
-	JobID          string
-	BatchNumber    int
-	TotalBatches   int
-	Status         string
-	RecipientsCount int
-	FilePath       string
-	EmailSent      bool
-	SentAt         string
-	ErrorMessage   string
-	CreatedAt      string
+	ID              string `json:"id"`
+	JobID           string `json:"job_id"`
+	BatchNumber     int    `json:"batch_number"`
+	TotalBatches    int    `json:"total_batches"`
+	Status          string `json:"status"`
+	RecipientsCount int    `json:"recipients_count"`
+	FilePath        string `json:"file_path,omitempty"`
+	EmailSent       bool   `json:"email_sent"`
+	SentAt          string `json:"sent_at,omitempty"`
+	ErrorMessage    string `json:"error_message,omitempty"`
+	CreatedAt       string `json:"created_at"`
+
+	// Modo RECIPIENT: alunos já atendidos, pulados quando o batch é retomado
+	SentUserIDs   []string `json:"sent_user_ids,omitempty"`
+	FailedUserIDs []string `json:"failed_user_ids,omitempty"` // Falhas do próprio aluno (sem email, CSV, destinatário recusado)
+}
+
+// ScanBatch lê um batch do banco de dados
+func ScanBatch(row *sql.Rows) (*Batch, error) {
+	var b Batch
+	var filePath, sentAt, errorMessage, createdAt sql.NullString
+	var sentUserIDs, failedUserIDs sql.NullString
+
+	err := row.Scan(
+		&b.ID,
+		&b.JobID,
+		&b.BatchNumber,
+		&b.TotalBatches,
+		&b.Status,
+		&b.RecipientsCount,
+		&filePath,
+		&b.EmailSent,
+		&sentAt,
+		&errorMessage,
+		&createdAt,
+		&sentUserIDs,
+		&failedUserIDs,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Campos opcionais
+	b.FilePath = filePath.String
+	b.SentAt = sentAt.String
+	b.ErrorMessage = errorMessage.String
+	b.CreatedAt = createdAt.String
+
+	if sentUserIDs.Valid {
+		if err := json.Unmarshal([]byte(sentUserIDs.String), &b.SentUserIDs); err != nil {
+			return nil, err
+		}
+	}
+	if failedUserIDs.Valid {
+		if err := json.Unmarshal([]byte(failedUserIDs.String), &b.FailedUserIDs); err != nil {
+			return nil, err
+		}
+	}
+
+	return &b, nil
 }
@@ -3,43 +3,190 @@ package models
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
 	"time"
 )
 
 // Job representa um job de exportação
 type Job struct {
-	ID           string
-	Type         string // "MANUAL" ou "MONTHLY_AUTO"
-	Status       string // "PENDING", "PROCESSING", "COMPLETED", "FAILED"
-	Priority     int
-	Payload      map[string]interface{}
-	Result       map[string]interface{}
-	ErrorMessage *string // NULL no banco de dados
-	CreatedAt    time.Time
-	StartedAt    *time.Time
-	CompletedAt  *time.Time
-	RetryCount   int
-	MaxRetries   int
-	LastRetryAt  *time.Time
+	ID           string                 `json:"id"`
+	Type         string                 `json:"type"`   // "MANUAL" ou "MONTHLY_AUTO"
+	Status       string                 `json:"status"` // "PENDING", "PROCESSING", "COMPLETED", "FAILED"
+	Priority     int                    `json:"priority"`
+	Payload      map[string]interface{} `json:"payload"`
+	Result       map[string]interface{} `json:"result"`
+	ErrorMessage *string                `json:"error_message"` // NULL no banco de dados
+	CreatedAt    time.Time              `json:"created_at"`
+	StartedAt    *time.Time             `json:"started_at"`
+	CompletedAt  *time.Time             `json:"completed_at"`
+	RetryCount   int                    `json:"retry_count"`
+	MaxRetries   int                    `json:"max_retries"`
+	LastRetryAt  *time.Time             `json:"last_retry_at"`
+
+	// Lease do worker que reivindicou o job
+	LeaseOwner     *string    `json:"lease_owner"`
+	LeaseExpiresAt *time.Time `json:"lease_expires_at"`
+
+	// Próxima tentativa (backoff após falha)
+	NextAttemptAt *time.Time `json:"next_attempt_at"`
+
+	// Cancelamento pedido enquanto o job estava em PROCESSING
+	CancelRequestedAt *time.Time `json:"cancel_requested_at"`
+
+	// Chave enviada pelo cliente para deduplicar enqueues
+	IdempotencyKey *string `json:"idempotency_key,omitempty"`
+
+	// Horário agendado; o job não roda antes disso
+	RunAt *time.Time `json:"run_at"`
 }
 
 // ExportJobPayload representa o payload de um job de exportação
 type ExportJobPayload struct {
 	UserIDs        []string  `json:"user_ids,omitempty"`
-	TurmaName      string    `json:"turma_name,omitempty"`
+	TurmaName      string    `json:"turma_name,omitempty"` // Seleciona a turma apenas quando UserIDs está vazio
+	TurmaIDs       []string  `json:"turma_ids,omitempty"`
+	TurmaNames     []string  `json:"turma_names,omitempty"`
+	AllConsenting  bool      `json:"all_consenting,omitempty"` // Resolve alunos com autoExportConsent na execução
 	StartDate      time.Time `json:"start_date"`
 	EndDate        time.Time `json:"end_date"`
 	ToEmail        string    `json:"to_email"`
 	BatchSize      int       `json:"batch_size,omitempty"`
 	ExportRecordID string    `json:"export_record_id,omitempty"`
 	Subject        string    `json:"subject,omitempty"`
+	DeliveryMode   string    `json:"delivery_mode,omitempty"` // "BATCH" (padrão) ou "RECIPIENT"
+	ScheduleID     string    `json:"schedule_id,omitempty"`   // Agendamento que criou o job
+}
+
+// Modos de entrega dos CSVs
+const (
+	// DeliveryModeBatch envia os CSVs do batch em um único email para ToEmail
+	DeliveryModeBatch = "BATCH"
+	// DeliveryModeRecipient envia a cada aluno apenas o próprio CSV em User.Email
+	DeliveryModeRecipient = "RECIPIENT"
+)
+
+// Tipos de job aceitos na fila
+const (
+	JobTypeManual      = "MANUAL"
+	JobTypeMonthlyAuto = "MONTHLY_AUTO"
+)
+
+// DefaultMaxRetries é o limite de tentativas quando o enqueue não informa max_retries
+const DefaultMaxRetries = 3
+
+// EnqueueRequest descreve um job a ser enfileirado
+type EnqueueRequest struct {
+	Type           string
+	Priority       int
+	MaxRetries     int
+	Payload        map[string]interface{}
+	IdempotencyKey string     // Opcional; deduplica enqueues repetidos
+	RunAt          *time.Time // Opcional; adia a execução até o horário informado
+}
+
+// ErrDuplicateIdempotencyKey indica que já existe um job com a mesma chave de idempotência
+var ErrDuplicateIdempotencyKey = errors.New("duplicate idempotency key")
+
+// FieldError descreve um campo inválido em uma requisição
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ParseExportJobPayload converte e valida o payload de um job de exportação.
+// Todos os problemas encontrados são retornados, não apenas o primeiro.
+func ParseExportJobPayload(raw map[string]interface{}) (ExportJobPayload, []FieldError) {
+	var payload ExportJobPayload
+	var errs []FieldError
+
+	// Datas são conferidas antes do decode para apontar o campo com erro
+	for _, field := range []string{"start_date", "end_date"} {
+		value, ok := raw[field]
+		if !ok || value == nil || value == "" {
+			errs = append(errs, FieldError{Field: field, Message: "is required"})
+			continue
+		}
+		s, ok := value.(string)
+		if !ok {
+			errs = append(errs, FieldError{Field: field, Message: "must be an RFC 3339 date string"})
+			continue
+		}
+		if _, err := time.Parse(time.RFC3339, s); err != nil {
+			errs = append(errs, FieldError{Field: field, Message: "must be an RFC 3339 date (e.g. 2025-01-31T23:59:59Z)"})
+		}
+	}
+	if len(errs) > 0 {
+		return payload, errs
+	}
+
+	payloadBytes, err := json.Marshal(raw)
+	if err != nil {
+		return payload, []FieldError{{Field: "payload", Message: err.Error()}}
+	}
+	if err := json.Unmarshal(payloadBytes, &payload); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return payload, []FieldError{{Field: typeErr.Field, Message: fmt.Sprintf("must be of type %s", typeErr.Type)}}
+		}
+		return payload, []FieldError{{Field: "payload", Message: err.Error()}}
+	}
+
+	return payload, payload.Validate()
+}
+
+// Validate confere as regras de negócio do payload de exportação
+func (p ExportJobPayload) Validate() []FieldError {
+	var errs []FieldError
+
+	if p.StartDate.IsZero() {
+		errs = append(errs, FieldError{Field: "start_date", Message: "is required"})
+	}
+	if p.EndDate.IsZero() {
+		errs = append(errs, FieldError{Field: "end_date", Message: "is required"})
+	}
+	if !p.StartDate.IsZero() && !p.EndDate.IsZero() && p.EndDate.Before(p.StartDate) {
+		errs = append(errs, FieldError{Field: "end_date", Message: "must be on or after start_date"})
+	}
+
+	if !p.AllConsenting && len(p.UserIDs) == 0 && p.TurmaName == "" && len(p.TurmaIDs) == 0 && len(p.TurmaNames) == 0 {
+		errs = append(errs, FieldError{Field: "user_ids", Message: "at least one target is required (user_ids, turma_ids, turma_names, turma_name or all_consenting)"})
+	}
+
+	switch p.DeliveryMode {
+	case "", DeliveryModeBatch:
+		// No modo BATCH os CSVs vão para to_email
+		if p.ToEmail == "" {
+			errs = append(errs, FieldError{Field: "to_email", Message: "is required when delivery_mode is BATCH"})
+		}
+	case DeliveryModeRecipient:
+	default:
+		errs = append(errs, FieldError{Field: "delivery_mode", Message: "must be BATCH or RECIPIENT"})
+	}
+
+	if p.ToEmail != "" && !validEmail(p.ToEmail) {
+		errs = append(errs, FieldError{Field: "to_email", Message: "must be a valid email address"})
+	}
+
+	if p.BatchSize < 0 {
+		errs = append(errs, FieldError{Field: "batch_size", Message: "must not be negative"})
+	}
+
+	return errs
+}
+
+// validEmail aceita apenas um endereço simples (sem nome de exibição)
+func validEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
 }
 
 // ScanJob lê um job do banco de dados
 func ScanJob(row *sql.Rows) (*Job, error) {
 	var j Job
-	var payloadJSON, resultJSON, errorMessage sql.NullString
-	var createdAtStr, startedAtStr, completedAtStr, lastRetryAtStr sql.NullString
+	var payloadJSON, resultJSON, errorMessage, leaseOwner, idempotencyKey sql.NullString
+	var createdAtStr, startedAtStr, completedAtStr, lastRetryAtStr, leaseExpiresAtStr, nextAttemptAtStr, cancelRequestedAtStr, runAtStr sql.NullString
 
 	err := row.Scan(
 		&j.ID,
@@ -55,6 +202,12 @@ func ScanJob(row *sql.Rows) (*Job, error) {
 		&j.RetryCount,
 		&j.MaxRetries,
 		&lastRetryAtStr,
+		&leaseOwner,
+		&leaseExpiresAtStr,
+		&nextAttemptAtStr,
+		&cancelRequestedAtStr,
+		&idempotencyKey,
+		&runAtStr,
 	)
 
 	if err != nil {
@@ -80,52 +233,61 @@ func ScanJob(row *sql.Rows) (*Job, error) {
 		j.ErrorMessage = &errorMessage.String
 	}
 
+	if leaseOwner.Valid {
+		j.LeaseOwner = &leaseOwner.String
+	}
+
+	if idempotencyKey.Valid {
+		j.IdempotencyKey = &idempotencyKey.String
+	}
+
 	// Parse created_at (obrigatório)
-	if createdAtStr.Valid && createdAtStr.String != "" {
-		createdAt, err := time.Parse("2006-01-02 15:04:05", createdAtStr.String)
-		if err != nil {
-			// Tenta outros formatos comuns
-			createdAt, err = time.Parse(time.RFC3339, createdAtStr.String)
-			if err != nil {
-				return nil, err
-			}
-		}
-		j.CreatedAt = createdAt
+	if createdAt, err := parseTime(createdAtStr); err != nil {
+		return nil, err
+	} else if createdAt != nil {
+		j.CreatedAt = *createdAt
 	}
 
 	// Parse nullable times
-	if startedAtStr.Valid && startedAtStr.String != "" {
-		startedAt, err := time.Parse("2006-01-02 15:04:05", startedAtStr.String)
-		if err != nil {
-			startedAt, err = time.Parse(time.RFC3339, startedAtStr.String)
-			if err != nil {
-				return nil, err
-			}
-		}
-		j.StartedAt = &startedAt
+	if j.StartedAt, err = parseTime(startedAtStr); err != nil {
+		return nil, err
+	}
+	if j.CompletedAt, err = parseTime(completedAtStr); err != nil {
+		return nil, err
+	}
+	if j.LastRetryAt, err = parseTime(lastRetryAtStr); err != nil {
+		return nil, err
+	}
+	if j.LeaseExpiresAt, err = parseTime(leaseExpiresAtStr); err != nil {
+		return nil, err
+	}
+	if j.NextAttemptAt, err = parseTime(nextAttemptAtStr); err != nil {
+		return nil, err
+	}
+	if j.CancelRequestedAt, err = parseTime(cancelRequestedAtStr); err != nil {
+		return nil, err
+	}
+	if j.RunAt, err = parseTime(runAtStr); err != nil {
+		return nil, err
 	}
 
-	if completedAtStr.Valid && completedAtStr.String != "" {
-		completedAt, err := time.Parse("2006-01-02 15:04:05", completedAtStr.String)
-		if err != nil {
-			completedAt, err = time.Parse(time.RFC3339, completedAtStr.String)
-			if err != nil {
-				return nil, err
-			}
-		}
-		j.CompletedAt = &completedAt
+	return &j, nil
+}
+
+// parseTime converte um DATETIME do SQLite (CURRENT_TIMESTAMP ou RFC3339)
+func parseTime(value sql.NullString) (*time.Time, error) {
+	if !value.Valid || value.String == "" {
+		return nil, nil
 	}
 
-	if lastRetryAtStr.Valid && lastRetryAtStr.String != "" {
-		lastRetryAt, err := time.Parse("2006-01-02 15:04:05", lastRetryAtStr.String)
+	t, err := time.Parse("2006-01-02 15:04:05", value.String)
+	if err != nil {
+		// Tenta outros formatos comuns
+		t, err = time.Parse(time.RFC3339, value.String)
 		if err != nil {
-			lastRetryAt, err = time.Parse(time.RFC3339, lastRetryAtStr.String)
-			if err != nil {
-				return nil, err
-			}
+			return nil, err
 		}
-		j.LastRetryAt = &lastRetryAt
 	}
 
-	return &j, nil
+	return &t, nil
 }
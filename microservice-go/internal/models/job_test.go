@@ -0,0 +1,148 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseExportJobPayload(t *testing.T) {
+	tests := []struct {
+		name   string
+		raw    map[string]interface{}
+		fields []string // Campos com erro, na ordem retornada
+	}{
+		{
+			name: "batch válido",
+			raw: map[string]interface{}{
+				"user_ids":   []interface{}{"u1", "u2"},
+				"start_date": "2025-01-01T00:00:00Z",
+				"end_date":   "2025-01-31T23:59:59Z",
+				"to_email":   "coord@escola.com",
+			},
+		},
+		{
+			name: "recipient sem to_email",
+			raw: map[string]interface{}{
+				"turma_ids":     []interface{}{"t1"},
+				"start_date":    "2025-01-01T00:00:00Z",
+				"end_date":      "2025-01-31T23:59:59Z",
+				"delivery_mode": "RECIPIENT",
+			},
+		},
+		{
+			name: "all_consenting como alvo",
+			raw: map[string]interface{}{
+				"all_consenting": true,
+				"start_date":     "2025-01-01T00:00:00Z",
+				"end_date":       "2025-01-31T23:59:59Z",
+				"delivery_mode":  "RECIPIENT",
+			},
+		},
+		{
+			name: "datas ausentes",
+			raw: map[string]interface{}{
+				"user_ids": []interface{}{"u1"},
+				"to_email": "coord@escola.com",
+			},
+			fields: []string{"start_date", "end_date"},
+		},
+		{
+			name: "data fora do RFC 3339",
+			raw: map[string]interface{}{
+				"user_ids":   []interface{}{"u1"},
+				"start_date": "01/01/2025",
+				"end_date":   "2025-01-31T23:59:59Z",
+				"to_email":   "coord@escola.com",
+			},
+			fields: []string{"start_date"},
+		},
+		{
+			name: "data com tipo errado",
+			raw: map[string]interface{}{
+				"user_ids":   []interface{}{"u1"},
+				"start_date": 20250101,
+				"end_date":   "2025-01-31T23:59:59Z",
+				"to_email":   "coord@escola.com",
+			},
+			fields: []string{"start_date"},
+		},
+		{
+			name: "fim antes do início",
+			raw: map[string]interface{}{
+				"user_ids":   []interface{}{"u1"},
+				"start_date": "2025-02-01T00:00:00Z",
+				"end_date":   "2025-01-01T00:00:00Z",
+				"to_email":   "coord@escola.com",
+			},
+			fields: []string{"end_date"},
+		},
+		{
+			name: "campo com tipo errado",
+			raw: map[string]interface{}{
+				"user_ids":   "u1",
+				"start_date": "2025-01-01T00:00:00Z",
+				"end_date":   "2025-01-31T23:59:59Z",
+				"to_email":   "coord@escola.com",
+			},
+			fields: []string{"user_ids"},
+		},
+		{
+			name: "todos os erros de regra juntos",
+			raw: map[string]interface{}{
+				"start_date":    "2025-01-01T00:00:00Z",
+				"end_date":      "2025-01-31T23:59:59Z",
+				"delivery_mode": "SMS",
+				"to_email":      "Coord <coord@escola.com>",
+				"batch_size":    -1,
+			},
+			fields: []string{"user_ids", "delivery_mode", "to_email", "batch_size"},
+		},
+		{
+			name: "batch sem to_email",
+			raw: map[string]interface{}{
+				"turma_name": "3A",
+				"start_date": "2025-01-01T00:00:00Z",
+				"end_date":   "2025-01-31T23:59:59Z",
+			},
+			fields: []string{"to_email"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, errs := ParseExportJobPayload(tt.raw)
+
+			var fields []string
+			for _, e := range errs {
+				fields = append(fields, e.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.fields) {
+				t.Errorf("campos com erro = %v, esperado %v (%+v)", fields, tt.fields, errs)
+			}
+		})
+	}
+}
+
+func TestParseExportJobPayloadDecodes(t *testing.T) {
+	payload, errs := ParseExportJobPayload(map[string]interface{}{
+		"turma_names":   []interface{}{"3A", "3B"},
+		"start_date":    "2025-01-01T00:00:00Z",
+		"end_date":      "2025-01-31T23:59:59Z",
+		"delivery_mode": "RECIPIENT",
+		"batch_size":    float64(10),
+		"schedule_id":   "sch_1",
+	})
+	if len(errs) > 0 {
+		t.Fatalf("erros inesperados: %+v", errs)
+	}
+
+	if !reflect.DeepEqual(payload.TurmaNames, []string{"3A", "3B"}) {
+		t.Errorf("TurmaNames = %v", payload.TurmaNames)
+	}
+	if payload.BatchSize != 10 || payload.DeliveryMode != DeliveryModeRecipient || payload.ScheduleID != "sch_1" {
+		t.Errorf("payload = %+v", payload)
+	}
+	if payload.EndDate.Day() != 31 {
+		t.Errorf("EndDate = %v", payload.EndDate)
+	}
+}
@@ -0,0 +1,187 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Alvos de um agendamento
+const (
+	ScheduleTargetTurma      = "TURMA"      // TargetIDs são IDs de turmas
+	ScheduleTargetUsers      = "USERS"      // TargetIDs são IDs de alunos
+	ScheduleTargetConsenting = "CONSENTING" // Alunos com autoExportConsent
+)
+
+// Regras de período de um agendamento, relativas ao disparo
+const (
+	PeriodLastWeek    = "LAST_WEEK"     // Semana anterior (segunda a domingo)
+	PeriodLastMonth   = "LAST_MONTH"    // Mês anterior completo
+	PeriodMonthToDate = "MONTH_TO_DATE" // Do dia 1 até o disparo
+)
+
+// ExportSchedule representa uma exportação recorrente gerenciada pelo banco
+type ExportSchedule struct {
+	ID           string     `json:"id"`
+	Name         string     `json:"name"`
+	Cron         string     `json:"cron"`
+	TargetType   string     `json:"target_type"`
+	TargetIDs    []string   `json:"target_ids"`
+	Period       string     `json:"period"`
+	DeliveryMode string     `json:"delivery_mode"`
+	ToEmail      string     `json:"to_email,omitempty"`
+	Enabled      bool       `json:"enabled"`
+	Version      int        `json:"version"` // Incrementado a cada alteração; usado no hot-reload
+	LastRunAt    *time.Time `json:"last_run_at"`
+	LastJobID    *string    `json:"last_job_id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// Validate confere os campos do agendamento (a expressão cron é validada pelo scheduler)
+func (s ExportSchedule) Validate() []FieldError {
+	var errs []FieldError
+
+	if s.Name == "" {
+		errs = append(errs, FieldError{Field: "name", Message: "is required"})
+	}
+	if s.Cron == "" {
+		errs = append(errs, FieldError{Field: "cron", Message: "is required"})
+	}
+
+	switch s.TargetType {
+	case ScheduleTargetTurma, ScheduleTargetUsers:
+		if len(s.TargetIDs) == 0 {
+			errs = append(errs, FieldError{Field: "target_ids", Message: "is required for target_type " + s.TargetType})
+		}
+	case ScheduleTargetConsenting:
+	default:
+		errs = append(errs, FieldError{Field: "target_type", Message: "must be TURMA, USERS or CONSENTING"})
+	}
+
+	switch s.Period {
+	case PeriodLastWeek, PeriodLastMonth, PeriodMonthToDate:
+	default:
+		errs = append(errs, FieldError{Field: "period", Message: "must be LAST_WEEK, LAST_MONTH or MONTH_TO_DATE"})
+	}
+
+	switch s.DeliveryMode {
+	case DeliveryModeBatch:
+		if s.ToEmail == "" {
+			errs = append(errs, FieldError{Field: "to_email", Message: "is required when delivery_mode is BATCH"})
+		}
+	case DeliveryModeRecipient:
+	default:
+		errs = append(errs, FieldError{Field: "delivery_mode", Message: "must be BATCH or RECIPIENT"})
+	}
+
+	if s.ToEmail != "" && !validEmail(s.ToEmail) {
+		errs = append(errs, FieldError{Field: "to_email", Message: "must be a valid email address"})
+	}
+
+	return errs
+}
+
+// Payload monta o payload do job de exportação para o período informado
+func (s ExportSchedule) Payload(start, end time.Time) map[string]interface{} {
+	payload := map[string]interface{}{
+		"schedule_id":   s.ID,
+		"delivery_mode": s.DeliveryMode,
+		"start_date":    start.Format(time.RFC3339),
+		"end_date":      end.Format(time.RFC3339),
+	}
+
+	if s.ToEmail != "" {
+		payload["to_email"] = s.ToEmail
+	}
+
+	switch s.TargetType {
+	case ScheduleTargetTurma:
+		payload["turma_ids"] = s.TargetIDs
+	case ScheduleTargetUsers:
+		payload["user_ids"] = s.TargetIDs
+	case ScheduleTargetConsenting:
+		payload["all_consenting"] = true
+	}
+
+	return payload
+}
+
+// PeriodRange calcula o intervalo [start, end] da regra de período em relação a now
+func PeriodRange(period string, now time.Time) (time.Time, time.Time, error) {
+	loc := now.Location()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+
+	switch period {
+	case PeriodLastWeek:
+		// Semanas começam na segunda-feira
+		weekday := (int(today.Weekday()) + 6) % 7
+		thisMonday := today.AddDate(0, 0, -weekday)
+		return thisMonday.AddDate(0, 0, -7), thisMonday.Add(-time.Second), nil
+	case PeriodLastMonth:
+		firstOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
+		return firstOfMonth.AddDate(0, -1, 0), firstOfMonth.Add(-time.Second), nil
+	case PeriodMonthToDate:
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc), now, nil
+	default:
+		return time.Time{}, time.Time{}, fmt.Errorf("unknown period: %s", period)
+	}
+}
+
+// ScanSchedule lê um agendamento do banco de dados
+func ScanSchedule(row *sql.Rows) (*ExportSchedule, error) {
+	var s ExportSchedule
+	var targetIDs, toEmail, lastJobID sql.NullString
+	var lastRunAtStr, createdAtStr, updatedAtStr sql.NullString
+
+	err := row.Scan(
+		&s.ID,
+		&s.Name,
+		&s.Cron,
+		&s.TargetType,
+		&targetIDs,
+		&s.Period,
+		&s.DeliveryMode,
+		&toEmail,
+		&s.Enabled,
+		&s.Version,
+		&lastRunAtStr,
+		&lastJobID,
+		&createdAtStr,
+		&updatedAtStr,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	s.TargetIDs = []string{}
+	if targetIDs.Valid && targetIDs.String != "" {
+		if err := json.Unmarshal([]byte(targetIDs.String), &s.TargetIDs); err != nil {
+			return nil, err
+		}
+	}
+
+	s.ToEmail = toEmail.String
+
+	if lastJobID.Valid {
+		s.LastJobID = &lastJobID.String
+	}
+
+	if s.LastRunAt, err = parseTime(lastRunAtStr); err != nil {
+		return nil, err
+	}
+	if createdAt, err := parseTime(createdAtStr); err != nil {
+		return nil, err
+	} else if createdAt != nil {
+		s.CreatedAt = *createdAt
+	}
+	if updatedAt, err := parseTime(updatedAtStr); err != nil {
+		return nil, err
+	} else if updatedAt != nil {
+		s.UpdatedAt = *updatedAt
+	}
+
+	return &s, nil
+}
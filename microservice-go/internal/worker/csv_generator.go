@@ -14,6 +14,7 @@ import (
 
 // CSVResult representa o resultado da geração de CSV
 type CSVResult struct {
+	UserID      string
 	FilePath    string
 	FileName    string
 	RecordCount int
@@ -110,6 +111,7 @@ func GenerateStudentCSV(user models.User, transactions []models.Transaction, sta
 	}
 
 	return &CSVResult{
+		UserID:      user.ID,
 		FilePath:    filePath,
 		FileName:    fileName,
 		RecordCount: len(transactions),
@@ -209,3 +211,10 @@ func calculateSummary(transactions []models.Transaction) Summary {
 func CleanupCSV(filePath string) error {
 	return os.Remove(filePath)
 }
+
+// cleanupCSVs remove os arquivos temporários de uma lista de resultados
+func cleanupCSVs(results []CSVResult) {
+	for _, r := range results {
+		CleanupCSV(r.FilePath)
+	}
+}
@@ -0,0 +1,66 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"educasa/internal/database"
+	"educasa/internal/models"
+)
+
+// syncEmailExports reflete o estado do job nos registros EmailExport do web-app.
+// Falhas são apenas registradas: o job não depende dessa tabela.
+func (jp *JobProcessor) syncEmailExports(ctx context.Context, job models.Job, update database.EmailExportUpdate) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+
+	update.JobID = job.ID
+	update.RecordID, _ = job.Payload["export_record_id"].(string)
+	if update.At.IsZero() {
+		update.At = time.Now()
+	}
+
+	// Atualizações do job inteiro não sobrescrevem o motivo dos alunos com falha definitiva
+	if len(update.UserIDs) == 0 {
+		update.ExcludeUserIDs = jp.failedRecipients(ctx, job.ID)
+	}
+
+	if _, err := database.UpdateEmailExports(ctx, jp.db, update); err != nil {
+		if database.IsMissingTable(err) {
+			log.Printf("Job %s: email_exports table not found, skipping export records sync", job.ID)
+			return
+		}
+		log.Printf("Job %s: error syncing email_exports (%s): %v", job.ID, update.Status, err)
+	}
+}
+
+// failedRecipients retorna os alunos do job com falha definitiva registrada nos batches
+func (jp *JobProcessor) failedRecipients(ctx context.Context, jobID string) []string {
+	batches, err := database.GetJobBatches(ctx, jp.db, jobID)
+	if err != nil {
+		log.Printf("Job %s: error reading failed recipients: %v", jobID, err)
+		return nil
+	}
+
+	var failed []string
+	for _, b := range batches {
+		failed = append(failed, b.FailedUserIDs...)
+	}
+	return failed
+}
+
+// SyncCancelledJob marca como FAILED os registros EmailExport de um job
+// cancelado antes de ser processado (POST /jobs/{id}/cancel)
+func (jp *JobProcessor) SyncCancelledJob(ctx context.Context, jobID string) {
+	job, err := database.GetJob(ctx, jp.db, jobID)
+	if err != nil {
+		log.Printf("Job %s: error loading cancelled job: %v", jobID, err)
+		return
+	}
+
+	jp.syncEmailExports(ctx, *job, database.EmailExportUpdate{
+		Status:       database.EmailExportFailed,
+		ErrorMessage: errJobCancelled.Error(),
+	})
+}
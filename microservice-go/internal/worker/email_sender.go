@@ -1,12 +1,12 @@
 package worker
 
 import (
-	"crypto/tls"
+	"context"
+	"crypto/x509"
 	"fmt"
-	"net"
-	"net/smtp"
+	"html"
+	"log"
 	"os"
-	"strings"
 	"time"
 
 	"educasa/internal/models"
@@ -14,25 +14,34 @@ import (
 
 // SMTPClient é um cliente SMTP para envio de emails
 type SMTPClient struct {
-	Host     string
-	Port     int
-	Username string
-	Password string
+	Host      string
+	Port      int
+	Username  string
+	Password  string
 	FromEmail string
 	FromName  string
+
+	TLSMode       string         // SMTPTLSStartTLS (padrão), SMTPTLSImplicit ou SMTPTLSNone
+	AuthMechanism string         // SMTPAuthPlain (padrão), SMTPAuthLogin, SMTPAuthCRAMMD5 ou SMTPAuthNone
+	RootCAs       *x509.CertPool // CAs para validar o servidor; nil usa as do sistema
 }
 
 // EmailAttachment representa um anexo de email
 type EmailAttachment struct {
-	Filename string
-	Content  []string // linhas do CSV
+	Filename    string
+	ContentType string // ex: "text/csv; charset=UTF-8"
+	Content     []byte // bytes do arquivo, enviados em base64
 }
 
+// csvContentType é o tipo dos CSVs gerados (com BOM UTF-8 para o Excel)
+const csvContentType = "text/csv; charset=UTF-8"
+
 // EmailRequest representa uma requisição de envio de email
 type EmailRequest struct {
 	To          string
 	Subject     string
 	HTML        string
+	Text        string // Alternativa text/plain; gerada a partir do HTML quando vazia
 	Attachments []EmailAttachment
 }
 
@@ -42,9 +51,18 @@ type BatchResult struct {
 	BatchNumber     int
 	RecipientsCount int
 	EmailSent       bool
+	EmailsSent      int
+	SentUserIDs     []string           // Alunos cujo CSV foi entregue
+	Failures        []RecipientFailure // Alunos que não podem receber o CSV
 	Errors          []string
 }
 
+// RecipientFailure é uma falha definitiva de um aluno no modo RECIPIENT
+type RecipientFailure struct {
+	UserID string
+	Reason string
+}
+
 // BatchInfo contém informações sobre o batch
 type BatchInfo struct {
 	BatchNumber  int
@@ -61,122 +79,26 @@ func NewSMTPClient(host string, port int, username, password, fromEmail, fromNam
 		Password:  password,
 		FromEmail: fromEmail,
 		FromName:  fromName,
-	}
-}
-
-// SendEmail envia um email via SMTP
-func (s *SMTPClient) SendEmail(req EmailRequest) (messageID string, err error) {
-	// Criar mensagem MIME
-	messageID = fmt.Sprintf("<%d@educasa.app.br>", time.Now().UnixNano())
-
-	var msg strings.Builder
-
-	// Headers
-	msg.WriteString(fmt.Sprintf("Message-ID: %s\r\n", messageID))
-	msg.WriteString(fmt.Sprintf("From: %s <%s>\r\n", s.FromName, s.FromEmail))
-	msg.WriteString(fmt.Sprintf("To: %s\r\n", req.To))
-	msg.WriteString(fmt.Sprintf("Subject: %s\r\n", req.Subject))
-	msg.WriteString("MIME-Version: 1.0\r\n")
-
-	// Boundary para multipart
-	boundary := fmt.Sprintf("boundary_%d", time.Now().UnixNano())
-
-	if len(req.Attachments) > 0 {
-		msg.WriteString(fmt.Sprintf("Content-Type: multipart/mixed; boundary=\"%s\"\r\n", boundary))
-		msg.WriteString("\r\n")
-
-		// Parte HTML
-		msg.WriteString(fmt.Sprintf("--%s\r\n", boundary))
-		msg.WriteString("Content-Type: text/html; charset=\"UTF-8\"\r\n")
-		msg.WriteString("\r\n")
-		msg.WriteString(req.HTML)
-		msg.WriteString("\r\n")
-
-		// Anexos
-		for _, att := range req.Attachments {
-			msg.WriteString(fmt.Sprintf("--%s\r\n", boundary))
-			msg.WriteString("Content-Type: text/csv; charset=\"UTF-8\"\r\n")
-			msg.WriteString(fmt.Sprintf("Content-Disposition: attachment; filename=\"%s\"\r\n", att.Filename))
-			msg.WriteString("\r\n")
-
-			// Conteúdo do CSV
-			csvContent := strings.Join(att.Content, "\n")
-			msg.WriteString(csvContent)
-			msg.WriteString("\r\n")
-		}
 
-		msg.WriteString(fmt.Sprintf("--%s--\r\n", boundary))
-	} else {
-		msg.WriteString("Content-Type: text/html; charset=\"UTF-8\"\r\n")
-		msg.WriteString("\r\n")
-		msg.WriteString(req.HTML)
-	}
-
-	// Conectar ao servidor SMTP
-	addr := fmt.Sprintf("%s:%d", s.Host, s.Port)
-
-	// Conexão simples (sem TLS inicial)
-	conn, err := net.Dial("tcp", addr)
-	if err != nil {
-		return "", fmt.Errorf("erro ao conectar: %w", err)
-	}
-	defer conn.Close()
-
-	client, err := smtp.NewClient(conn, s.Host)
-	if err != nil {
-		return "", fmt.Errorf("erro ao criar cliente SMTP: %w", err)
-	}
-	defer client.Close()
-
-	// Configurar TLS para STARTTLS
-	tlsConfig := &tls.Config{
-		InsecureSkipVerify: false,
-		ServerName:         s.Host,
-	}
-
-	// Iniciar TLS (STARTTLS para porta 587)
-	if err := client.StartTLS(tlsConfig); err != nil {
-		return "", fmt.Errorf("erro ao iniciar TLS: %w", err)
-	}
-
-	// Autenticação
-	auth := smtp.PlainAuth("", s.Username, s.Password, s.Host)
-	if err := client.Auth(auth); err != nil {
-		return "", fmt.Errorf("erro na autenticação SMTP: %w", err)
-	}
-
-	// Configurar remetente
-	if err := client.Mail(s.FromEmail); err != nil {
-		return "", fmt.Errorf("erro ao definir remetente: %w", err)
-	}
-
-	// Configurar destinatário
-	if err := client.Rcpt(req.To); err != nil {
-		return "", fmt.Errorf("erro ao definir destinatário: %w", err)
-	}
-
-	// Enviar corpo do email
-	writer, err := client.Data()
-	if err != nil {
-		return "", fmt.Errorf("erro ao preparar envio: %w", err)
-	}
-
-	_, err = writer.Write([]byte(msg.String()))
-	if err != nil {
-		return "", fmt.Errorf("erro ao escrever mensagem: %w", err)
+		// Padrões: STARTTLS e AUTH PLAIN
+		TLSMode:       SMTPTLSStartTLS,
+		AuthMechanism: SMTPAuthPlain,
 	}
+}
 
-	err = writer.Close()
-	if err != nil {
-		return "", fmt.Errorf("erro ao fechar writer: %w", err)
-	}
+// SendEmail envia um email via SMTP em uma conexão própria.
+// Jobs usam OpenSession para reaproveitar a conexão entre emails.
+func (s *SMTPClient) SendEmail(ctx context.Context, req EmailRequest) (messageID string, err error) {
+	session := s.OpenSession()
+	defer session.Close()
 
-	return messageID, nil
+	return session.SendEmail(ctx, req)
 }
 
 // SendBatchEmails envia um batch de CSVs em um único email
 func SendBatchEmails(
-	client *SMTPClient,
+	ctx context.Context,
+	mailer Mailer,
 	users []models.User,
 	csvResults []CSVResult,
 	toEmail string,
@@ -185,6 +107,7 @@ func SendBatchEmails(
 ) (*BatchResult, error) {
 	// Preparar anexos (ler arquivos)
 	attachments := make([]EmailAttachment, 0, len(csvResults))
+	userIDs := make([]string, 0, len(csvResults))
 	errors := make([]string, 0)
 
 	for _, csv := range csvResults {
@@ -194,13 +117,12 @@ func SendBatchEmails(
 			continue
 		}
 
-		// Dividir em linhas
-		lines := strings.Split(string(fileContent), "\n")
-
 		attachments = append(attachments, EmailAttachment{
-			Filename: csv.FileName,
-			Content:  lines,
+			Filename:    csv.FileName,
+			ContentType: csvContentType,
+			Content:     fileContent,
 		})
+		userIDs = append(userIDs, csv.UserID)
 
 		// Agendar limpeza do arquivo temporário
 		defer CleanupCSV(csv.FilePath)
@@ -221,7 +143,7 @@ func SendBatchEmails(
 	html := buildEmailHTML(exportType, batchInfo, users)
 
 	// Enviar
-	messageID, err := client.SendEmail(EmailRequest{
+	messageID, err := mailer.SendEmail(ctx, EmailRequest{
 		To:          toEmail,
 		Subject:     subject,
 		HTML:        html,
@@ -239,22 +161,130 @@ func SendBatchEmails(
 		}, err
 	}
 
-	fmt.Printf("Email enviado com sucesso: %s\n", messageID)
+	log.Printf("Email enviado com sucesso: %s", messageID)
 
 	return &BatchResult{
 		Success:         true,
 		BatchNumber:     batchInfo.BatchNumber,
 		RecipientsCount: len(users),
 		EmailSent:       true,
+		EmailsSent:      1,
+		SentUserIDs:     userIDs,
 		Errors:          errors,
 	}, nil
 }
 
+// SendRecipientEmails envia a cada aluno do batch um email com o próprio CSV.
+// Problemas do próprio aluno (sem email, CSV não gerado, destinatário recusado)
+// entram em Failures e não falham o batch. Um erro de envio interrompe o batch
+// e é retornado; o retry retoma a partir dos alunos ainda não atendidos.
+func SendRecipientEmails(
+	ctx context.Context,
+	mailer Mailer,
+	users []models.User,
+	csvResults []CSVResult,
+	exportType string,
+	batchInfo BatchInfo,
+	startDate, endDate time.Time,
+) (*BatchResult, error) {
+	// Indexar CSVs por aluno
+	csvByUser := make(map[string]CSVResult, len(csvResults))
+	for _, csv := range csvResults {
+		csvByUser[csv.UserID] = csv
+		defer CleanupCSV(csv.FilePath)
+	}
+
+	errors := make([]string, 0)
+	sentUserIDs := make([]string, 0, len(users))
+	failures := make([]RecipientFailure, 0)
+	var sendErr error
+
+	for _, user := range users {
+		// Interromper se o job expirou ou foi cancelado
+		if err := ctx.Err(); err != nil {
+			sendErr = fmt.Errorf("envio interrompido: %w", err)
+			errors = append(errors, sendErr.Error())
+			break
+		}
+
+		csv, ok := csvByUser[user.ID]
+		if !ok {
+			failures = append(failures, RecipientFailure{UserID: user.ID, Reason: fmt.Sprintf("CSV não gerado para o aluno %s", user.ID)})
+			continue
+		}
+
+		if user.Email == "" {
+			failures = append(failures, RecipientFailure{UserID: user.ID, Reason: fmt.Sprintf("Aluno %s sem email", user.ID)})
+			continue
+		}
+
+		fileContent, err := os.ReadFile(csv.FilePath)
+		if err != nil {
+			failures = append(failures, RecipientFailure{UserID: user.ID, Reason: fmt.Sprintf("Erro ao ler CSV %s: %v", csv.FileName, err)})
+			continue
+		}
+
+		messageID, err := mailer.SendEmail(ctx, EmailRequest{
+			To:      user.Email,
+			Subject: buildStudentEmailSubject(exportType),
+			HTML:    buildStudentEmailHTML(exportType, user, startDate, endDate),
+			Attachments: []EmailAttachment{{
+				Filename:    csv.FileName,
+				ContentType: csvContentType,
+				Content:     fileContent,
+			}},
+		})
+		if isRecipientRejected(err) {
+			failures = append(failures, RecipientFailure{UserID: user.ID, Reason: fmt.Sprintf("Email recusado para %s: %v", user.Email, err)})
+			continue
+		}
+		if err != nil {
+			// Falha de transporte ou cota: os demais alunos ficam para o retry
+			sendErr = err
+			errors = append(errors, fmt.Sprintf("Erro ao enviar email para %s: %v", user.Email, err))
+			break
+		}
+
+		log.Printf("Email enviado para %s: %s", user.Email, messageID)
+		sentUserIDs = append(sentUserIDs, user.ID)
+	}
+
+	for _, f := range failures {
+		errors = append(errors, f.Reason)
+	}
+
+	return &BatchResult{
+		Success:         len(errors) == 0,
+		BatchNumber:     batchInfo.BatchNumber,
+		RecipientsCount: len(users),
+		EmailSent:       sendErr == nil,
+		EmailsSent:      len(sentUserIDs),
+		SentUserIDs:     sentUserIDs,
+		Failures:        failures,
+		Errors:          errors,
+	}, sendErr
+}
+
+// exportTypeScheduled identifica nos textos do email os jobs criados por um
+// agendamento de export_schedules (gravados como MANUAL na fila)
+const exportTypeScheduled = "SCHEDULED"
+
+// emailExportType retorna o tipo usado nos textos do email do job
+func emailExportType(jobType string, payload models.ExportJobPayload) string {
+	if payload.ScheduleID != "" {
+		return exportTypeScheduled
+	}
+	return jobType
+}
+
 // buildEmailSubject constrói assunto do email
 func buildEmailSubject(exportType string, batchInfo BatchInfo) string {
 	typeLabel := "Exportação de Dados"
-	if exportType == "MONTHLY_AUTO" {
+	switch exportType {
+	case "MONTHLY_AUTO":
 		typeLabel = "Relatório Mensal"
+	case exportTypeScheduled:
+		typeLabel = "Exportação Agendada"
 	}
 
 	if batchInfo.TotalBatches > 1 {
@@ -266,10 +296,12 @@ func buildEmailSubject(exportType string, batchInfo BatchInfo) string {
 
 // buildEmailHTML constrói HTML do email
 func buildEmailHTML(exportType string, batchInfo BatchInfo, users []models.User) string {
-	isMonthly := exportType == "MONTHLY_AUTO"
-	title := "Relatórios Mensais de Alunos"
-	if !isMonthly {
-		title = "Exportação de Dados Solicitada"
+	title := "Exportação de Dados Solicitada"
+	switch exportType {
+	case "MONTHLY_AUTO":
+		title = "Relatórios Mensais de Alunos"
+	case exportTypeScheduled:
+		title = "Exportação Agendada de Dados"
 	}
 
 	batchInfoHTML := ""
@@ -320,13 +352,78 @@ func buildEmailHTML(exportType string, batchInfo BatchInfo, users []models.User)
       </div>
     </body>
     </html>
-    `, title, userListHTML, batchInfoHTML, getAutoMessage(isMonthly))
+    `, title, userListHTML, batchInfoHTML, getAutoMessage(exportType))
+}
+
+// buildStudentEmailSubject constrói assunto do email enviado ao aluno
+func buildStudentEmailSubject(exportType string) string {
+	if exportType == "MONTHLY_AUTO" {
+		return "Seu Relatório Mensal - Educa.SA"
+	}
+	return "Seu Histórico Financeiro - Educa.SA"
+}
+
+// buildStudentEmailHTML constrói HTML do email enviado ao aluno
+func buildStudentEmailHTML(exportType string, user models.User, startDate, endDate time.Time) string {
+	title := "Seu Relatório Mensal"
+	if exportType != "MONTHLY_AUTO" {
+		title = "Seu Histórico Financeiro"
+	}
+
+	return fmt.Sprintf(`
+    <!DOCTYPE html>
+    <html>
+    <head>
+      <meta charset="utf-8">
+      <style>
+        body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+        .container { max-width: 600px; margin: 0 auto; padding: 20px; }
+        .header { background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%); color: white; padding: 20px; border-radius: 8px 8px 0 0; }
+        .content { background: #f9f9f9; padding: 20px; border-radius: 0 0 8px 8px; }
+        .footer { margin-top: 20px; padding: 15px; background: #f0f0f0; border-radius: 8px; font-size: 12px; color: #666; }
+      </style>
+    </head>
+    <body>
+      <div class="container">
+        <div class="header">
+          <h1 style="margin: 0;">%s</h1>
+        </div>
+        <div class="content">
+          <p>Olá, %s!</p>
+          <p>Em anexo você encontrará o seu histórico financeiro do período de <strong>%s</strong> a <strong>%s</strong>.</p>
+          <p>O arquivo CSV pode ser aberto no Excel, LibreOffice ou Google Planilhas.</p>
+          <p style="margin-top: 20px; font-size: 14px; color: #666;">
+            %s
+          </p>
+        </div>
+        <div class="footer">
+          <p><strong>Educa.SA</strong> - Educação Financeira na Sala de Ação</p>
+          <p>Este é um email automático, por favor não responda.</p>
+        </div>
+      </div>
+    </body>
+    </html>
+    `, title, html.EscapeString(user.Name), formatDate(startDate), formatDate(endDate), getStudentMessage(exportType))
+}
+
+// getStudentMessage retorna mensagem de rodapé para o aluno
+func getStudentMessage(exportType string) string {
+	switch exportType {
+	case "MONTHLY_AUTO":
+		return "Você está recebendo este email porque autorizou o envio automático dos seus relatórios. Para deixar de recebê-los, desative a opção no seu perfil."
+	case exportTypeScheduled:
+		return "Este relatório foi enviado automaticamente por um agendamento da coordenação."
+	}
+	return "Este relatório foi enviado a pedido da coordenação através do painel."
 }
 
-// getAutoMessage retorna mensagem apropriada para exportação automática
-func getAutoMessage(isMonthly bool) string {
-	if isMonthly {
+// getAutoMessage retorna mensagem de rodapé conforme a origem da exportação
+func getAutoMessage(exportType string) string {
+	switch exportType {
+	case "MONTHLY_AUTO":
 		return "Estes relatórios foram gerados automaticamente pelo sistema Educa.SA."
+	case exportTypeScheduled:
+		return "Esta exportação foi gerada automaticamente por um agendamento configurado no painel."
 	}
 	return "Esta exportação foi solicitada manualmente através do painel."
 }
@@ -0,0 +1,163 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HTTPMailer envia emails pela API HTTP de um provedor transacional (formato ZeptoMail)
+type HTTPMailer struct {
+	URL       string
+	Token     string
+	FromEmail string
+	FromName  string
+	client    *http.Client
+}
+
+// zeptoAddress é um endereço no corpo da requisição
+type zeptoAddress struct {
+	Address string `json:"address"`
+	Name    string `json:"name,omitempty"`
+}
+
+type zeptoRecipient struct {
+	EmailAddress zeptoAddress `json:"email_address"`
+}
+
+type zeptoAttachment struct {
+	Content  string `json:"content"` // base64
+	MimeType string `json:"mime_type"`
+	Name     string `json:"name"`
+}
+
+type zeptoRequest struct {
+	From        zeptoAddress      `json:"from"`
+	To          []zeptoRecipient  `json:"to"`
+	Subject     string            `json:"subject"`
+	HTMLBody    string            `json:"htmlbody"`
+	TextBody    string            `json:"textbody,omitempty"`
+	Attachments []zeptoAttachment `json:"attachments,omitempty"`
+}
+
+type zeptoResponse struct {
+	RequestID string `json:"request_id"`
+	Message   string `json:"message"`
+}
+
+// zeptoError é o corpo de uma resposta de erro; details aponta o campo recusado
+type zeptoError struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+		Details []struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+			Target  string `json:"target"`
+		} `json:"details"`
+	} `json:"error"`
+}
+
+// NewHTTPMailer cria um cliente para a API de envio
+func NewHTTPMailer(url, token, fromEmail, fromName string, timeout time.Duration) *HTTPMailer {
+	return &HTTPMailer{
+		URL:       url,
+		Token:     token,
+		FromEmail: fromEmail,
+		FromName:  fromName,
+		client:    &http.Client{Timeout: timeout},
+	}
+}
+
+// SendEmail envia o email e retorna o request_id devolvido pela API
+func (h *HTTPMailer) SendEmail(ctx context.Context, req EmailRequest) (messageID string, err error) {
+	body := zeptoRequest{
+		From:     zeptoAddress{Address: h.FromEmail, Name: h.FromName},
+		To:       []zeptoRecipient{{EmailAddress: zeptoAddress{Address: req.To}}},
+		Subject:  req.Subject,
+		HTMLBody: req.HTML,
+		TextBody: req.Text,
+	}
+	if body.TextBody == "" {
+		body.TextBody = htmlToText(req.HTML)
+	}
+	for _, att := range req.Attachments {
+		mimeType := defaultAttachmentType
+		if mediaType, _, err := mime.ParseMediaType(att.ContentType); err == nil {
+			mimeType = mediaType
+		}
+		body.Attachments = append(body.Attachments, zeptoAttachment{
+			Content:  base64.StdEncoding.EncodeToString(att.Content),
+			MimeType: mimeType,
+			Name:     att.Filename,
+		})
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return "", fmt.Errorf("erro ao montar requisição: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(payload))
+	if err != nil {
+		return "", fmt.Errorf("erro ao montar requisição: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "application/json")
+	httpReq.Header.Set("Authorization", "Zoho-enczapikey "+h.Token)
+
+	resp, err := h.client.Do(httpReq)
+	if err != nil {
+		return "", fmt.Errorf("erro ao chamar API de email: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		err := fmt.Errorf("API de email retornou %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+		if recipientRejected(resp.StatusCode, respBody) {
+			return "", fmt.Errorf("%w: %w", ErrRecipientRejected, err)
+		}
+		return "", err
+	}
+
+	var result zeptoResponse
+	if err := json.Unmarshal(respBody, &result); err != nil || result.RequestID == "" {
+		// Envio aceito, mas sem identificador legível
+		return fmt.Sprintf("http-%d", time.Now().UnixNano()), nil
+	}
+
+	return result.RequestID, nil
+}
+
+// recipientRejected informa se a resposta de erro recusa o destinatário: 4xx com
+// detalhe apontando para o campo "to". Autenticação, limite de taxa e timeout
+// não dependem do destinatário e seguem como erro do envio.
+func recipientRejected(status int, body []byte) bool {
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return false
+	}
+	if status < 400 || status >= 500 {
+		return false
+	}
+
+	var apiErr zeptoError
+	if err := json.Unmarshal(body, &apiErr); err != nil {
+		return false
+	}
+	for _, detail := range apiErr.Error.Details {
+		target := strings.ToLower(detail.Target)
+		if target == "to" || strings.HasPrefix(target, "to.") || strings.HasPrefix(target, "to[") || target == "email_address" || target == "address" {
+			return true
+		}
+	}
+	return false
+}
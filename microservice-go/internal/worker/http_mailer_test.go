@@ -0,0 +1,180 @@
+package worker
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPMailerSendEmail(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		response   string
+		wantID     string // Vazio: ID gerado localmente
+		wantErr    string
+		wantPrefix string
+	}{
+		{
+			name:     "aceito com request_id",
+			status:   http.StatusCreated,
+			response: `{"request_id":"req-123","message":"OK"}`,
+			wantID:   "req-123",
+		},
+		{
+			name:       "aceito sem corpo legível",
+			status:     http.StatusOK,
+			response:   `ok`,
+			wantPrefix: "http-",
+		},
+		{
+			name:     "recusado",
+			status:   http.StatusUnauthorized,
+			response: `{"error":{"code":"TM_3201","message":"Invalid API Token"}}`,
+			wantErr:  "API de email retornou 401: " + `{"error":{"code":"TM_3201","message":"Invalid API Token"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got zeptoRequest
+			var header http.Header
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				header = r.Header.Clone()
+				if r.Method != http.MethodPost {
+					t.Errorf("método = %s", r.Method)
+				}
+				if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+					t.Errorf("corpo inválido: %v", err)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			mailer := NewHTTPMailer(server.URL, "tok", "noreply@educasa.app.br", "Educa.SA", 5*time.Second)
+			messageID, err := mailer.SendEmail(context.Background(), EmailRequest{
+				To:          "aluno@escola.com",
+				Subject:     "Relatório",
+				HTML:        "<p>Olá</p>",
+				Attachments: []EmailAttachment{{Filename: "r.csv", ContentType: csvContentType, Content: []byte("a;b\n")}},
+			})
+
+			switch {
+			case tt.wantErr != "":
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("erro = %v, esperado %q", err, tt.wantErr)
+				}
+			case err != nil:
+				t.Fatal(err)
+			case tt.wantID != "" && messageID != tt.wantID:
+				t.Errorf("messageID = %q, esperado %q", messageID, tt.wantID)
+			case tt.wantPrefix != "" && !strings.HasPrefix(messageID, tt.wantPrefix):
+				t.Errorf("messageID = %q, esperado prefixo %q", messageID, tt.wantPrefix)
+			}
+
+			if auth := header.Get("Authorization"); auth != "Zoho-enczapikey tok" {
+				t.Errorf("Authorization = %q", auth)
+			}
+			if ct := header.Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q", ct)
+			}
+
+			if got.From.Address != "noreply@educasa.app.br" || got.From.Name != "Educa.SA" {
+				t.Errorf("from = %+v", got.From)
+			}
+			if len(got.To) != 1 || got.To[0].EmailAddress.Address != "aluno@escola.com" {
+				t.Errorf("to = %+v", got.To)
+			}
+			if got.Subject != "Relatório" || got.HTMLBody != "<p>Olá</p>" || got.TextBody != "Olá" {
+				t.Errorf("subject/htmlbody/textbody = %q / %q / %q", got.Subject, got.HTMLBody, got.TextBody)
+			}
+			if len(got.Attachments) != 1 {
+				t.Fatalf("%d anexos, esperado 1", len(got.Attachments))
+			}
+			att := got.Attachments[0]
+			content, _ := base64.StdEncoding.DecodeString(att.Content)
+			if att.Name != "r.csv" || att.MimeType != "text/csv" || string(content) != "a;b\n" {
+				t.Errorf("anexo = %s (%s): %q", att.Name, att.MimeType, content)
+			}
+		})
+	}
+}
+
+func TestHTTPMailerTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	mailer := NewHTTPMailer(server.URL, "tok", "noreply@educasa.app.br", "Educa.SA", 50*time.Millisecond)
+	if _, err := mailer.SendEmail(context.Background(), EmailRequest{To: "aluno@escola.com", HTML: "<p>x</p>"}); err == nil {
+		t.Fatal("esperado erro de timeout")
+	}
+}
+
+func TestHTTPMailerRecipientRejected(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		response string
+		rejected bool
+	}{
+		{
+			name:     "endereço inválido",
+			status:   http.StatusBadRequest,
+			response: `{"error":{"code":"TM_3301","details":[{"code":"SM_128","message":"Invalid email address","target":"to"}],"message":"Invalid value"}}`,
+			rejected: true,
+		},
+		{
+			name:     "endereço do destinatário",
+			status:   http.StatusUnprocessableEntity,
+			response: `{"error":{"code":"TM_3301","details":[{"code":"SM_128","message":"Invalid","target":"email_address"}]}}`,
+			rejected: true,
+		},
+		{
+			name:     "outro campo inválido",
+			status:   http.StatusBadRequest,
+			response: `{"error":{"code":"TM_3301","details":[{"code":"GE_102","message":"Mandatory field","target":"subject"}]}}`,
+		},
+		{
+			name:     "limite de taxa",
+			status:   http.StatusTooManyRequests,
+			response: `{"error":{"code":"TM_4001","details":[{"target":"to"}]}}`,
+		},
+		{
+			name:     "corpo ilegível",
+			status:   http.StatusBadRequest,
+			response: `bad request`,
+		},
+		{
+			name:     "erro do servidor",
+			status:   http.StatusInternalServerError,
+			response: `{"error":{"details":[{"target":"to"}]}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			mailer := NewHTTPMailer(server.URL, "tok", "noreply@educasa.app.br", "Educa.SA", 5*time.Second)
+			_, err := mailer.SendEmail(context.Background(), EmailRequest{To: "invalido@", HTML: "<p>x</p>"})
+			if err == nil {
+				t.Fatal("esperado erro")
+			}
+			if got := isRecipientRejected(err); got != tt.rejected {
+				t.Errorf("isRecipientRejected = %v, esperado %v (%v)", got, tt.rejected, err)
+			}
+		})
+	}
+}
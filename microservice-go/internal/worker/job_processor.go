@@ -4,8 +4,12 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"educasa/internal/config"
@@ -13,44 +17,146 @@ import (
 	"educasa/internal/models"
 )
 
-// JobProcessor processa jobs da fila
+// Motivos de cancelamento do contexto de um job
+var (
+	errJobTimeout = errors.New("job excedeu o tempo limite")
+	errLeaseLost  = errors.New("lease do job perdido")
+
+	// Parada a pedido (POST /jobs/{id}/cancel)
+	errJobCancelled = errors.New("job cancelado")
+)
+
+// JobProcessor processa jobs da fila com no máximo MaxConcurrentJobs simultâneos
 type JobProcessor struct {
-	db          *sql.DB
-	emailClient *SMTPClient
-	cfg         *config.Config
+	db     *sql.DB
+	mailer Mailer
+	cfg    *config.Config
+
+	// Limite de envios compartilhado por todos os jobs
+	limiter *RateLimiter
+
+	// Backoff entre tentativas
+	defaultRetryPolicy RetryPolicy
+	retryPolicies      map[string]RetryPolicy
+
+	// Pool de execução
+	slots      chan struct{}
+	wg         sync.WaitGroup
+	jobsCtx    context.Context
+	cancelJobs context.CancelFunc
 }
 
 // NewJobProcessor cria um novo processador de jobs
-func NewJobProcessor(db *sql.DB, emailClient *SMTPClient, cfg *config.Config) *JobProcessor {
+func NewJobProcessor(db *sql.DB, mailer Mailer, cfg *config.Config) *JobProcessor {
+	maxJobs := cfg.MaxConcurrentJobs
+	if maxJobs < 1 {
+		maxJobs = 1
+	}
+
+	jobsCtx, cancelJobs := context.WithCancel(context.Background())
+
 	return &JobProcessor{
-		db:          db,
-		emailClient: emailClient,
-		cfg:         cfg,
+		db:      db,
+		mailer:  mailer,
+		cfg:     cfg,
+		limiter: NewRateLimiter(db, cfg.MailRatePerMinute, cfg.MailRatePerDay, quotaLocation(cfg.MailRateTimezone)),
+		defaultRetryPolicy: RetryPolicy{
+			BaseDelay:  cfg.RetryBaseDelay,
+			MaxDelay:   cfg.RetryMaxDelay,
+			Multiplier: 2,
+			Jitter:     0.2,
+		},
+		retryPolicies: make(map[string]RetryPolicy),
+		slots:         make(chan struct{}, maxJobs),
+		jobsCtx:       jobsCtx,
+		cancelJobs:    cancelJobs,
 	}
 }
 
-// Start inicia o processamento de jobs
+// Start inicia o processamento de jobs.
+// Cancelar ctx interrompe a busca de novos jobs; os jobs em andamento
+// continuam até Shutdown.
 func (jp *JobProcessor) Start(ctx context.Context) {
 	ticker := time.NewTicker(jp.cfg.WorkerPollInterval)
 	defer ticker.Stop()
 
-	log.Println("Job processor started")
+	reaperTicker := time.NewTicker(jp.cfg.ReaperInterval)
+	defer reaperTicker.Stop()
+
+	log.Printf("Job processor started (max concurrent jobs: %d)", cap(jp.slots))
+
+	// Recuperar jobs abandonados por uma execução anterior
+	jp.reapStuckJobs(ctx)
 
 	for {
 		select {
 		case <-ctx.Done():
 			log.Println("Job processor stopped")
 			return
+		case <-reaperTicker.C:
+			jp.reapStuckJobs(ctx)
 		case <-ticker.C:
 			jp.processJobs(ctx)
 		}
 	}
 }
 
-// processJobs busca e processa jobs pendentes
+// Shutdown aguarda os jobs em andamento terminarem.
+// Se ctx expirar antes, os jobs são cancelados e devolvidos à fila.
+func (jp *JobProcessor) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		jp.wg.Wait()
+		close(done)
+	}()
+
+	log.Printf("Waiting for %d in-flight jobs", jp.InFlight())
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		log.Printf("Shutdown timeout, cancelling %d in-flight jobs", jp.InFlight())
+		jp.cancelJobs()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// InFlight retorna o número de jobs em processamento nesta réplica
+func (jp *JobProcessor) InFlight() int {
+	return len(jp.slots)
+}
+
+// quotaLocation carrega o fuso da cota diária (validado em config.Load)
+func quotaLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		log.Printf("Invalid MAIL_RATE_TIMEZONE %q, using UTC: %v", name, err)
+		return time.UTC
+	}
+	return loc
+}
+
+// Capacity retorna o número máximo de jobs simultâneos
+func (jp *JobProcessor) Capacity() int {
+	return cap(jp.slots)
+}
+
+// MailQuota retorna o uso dos limites de envio (cota diária de todas as réplicas)
+func (jp *JobProcessor) MailQuota(ctx context.Context) RateLimitStats {
+	return jp.limiter.Stats(ctx)
+}
+
+// processJobs busca e processa jobs pendentes conforme os slots livres
 func (jp *JobProcessor) processJobs(ctx context.Context) {
+	free := cap(jp.slots) - len(jp.slots)
+	if free <= 0 {
+		return
+	}
+
 	// Buscar próximos jobs pendentes
-	jobs, err := jp.fetchPendingJobs(ctx, jp.cfg.MaxConcurrentJobs)
+	jobs, err := jp.fetchPendingJobs(ctx, free)
 	if err != nil {
 		log.Printf("Error fetching jobs: %v", err)
 		return
@@ -60,59 +166,94 @@ func (jp *JobProcessor) processJobs(ctx context.Context) {
 		return
 	}
 
-	log.Printf("Processing %d jobs", len(jobs))
-
-	// Processar jobs em paralelo
+	// Reivindicar e processar jobs em paralelo
+	claimed := 0
 	for _, job := range jobs {
-		go jp.processJob(context.Background(), job)
+		// Reservar slot antes de reivindicar
+		select {
+		case jp.slots <- struct{}{}:
+		default:
+			return
+		}
+
+		ok, err := jp.claimJob(ctx, job.ID)
+		if err != nil || !ok {
+			<-jp.slots
+			if err != nil {
+				log.Printf("Error claiming job %s: %v", job.ID, err)
+			}
+			// Se !ok, outro worker reivindicou primeiro
+			continue
+		}
+
+		claimed++
+		jp.wg.Add(1)
+		go func(job models.Job) {
+			defer jp.wg.Done()
+			defer func() { <-jp.slots }()
+			jp.processJob(jp.jobsCtx, job)
+		}(job)
+	}
+
+	if claimed > 0 {
+		log.Printf("Processing %d jobs (worker %s, %d/%d slots in use)", claimed, jp.cfg.WorkerID, len(jp.slots), cap(jp.slots))
 	}
 }
 
 // fetchPendingJobs busca jobs pendentes do banco
 func (jp *JobProcessor) fetchPendingJobs(ctx context.Context, limit int) ([]models.Job, error) {
-	query := `
-		SELECT id, type, status, priority, payload, result, error_message,
-		       created_at, started_at, completed_at, retry_count, max_retries, last_retry_at
-		FROM export_jobs
-		WHERE status = 'PENDING'
-		   OR (status = 'FAILED' AND retry_count < max_retries)
-		ORDER BY priority DESC, created_at ASC
-		LIMIT ?
-	`
-
-	rows, err := jp.db.QueryContext(ctx, query, limit)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+	return database.GetPendingJobs(ctx, jp.db, limit)
+}
 
-	jobs := []models.Job{}
-	for rows.Next() {
-		log.Println("Fetching job...:%v", rows)
-		job, err := models.ScanJob(rows)
-		if err != nil {
-			log.Printf("Error scanning job: %v", err)
-			continue
+// claimJob reivindica um job atomicamente para este worker
+func (jp *JobProcessor) claimJob(ctx context.Context, jobID string) (bool, error) {
+	return database.ClaimJob(ctx, jp.db, jobID, jp.cfg.WorkerID, time.Now().Add(jp.cfg.JobLeaseDuration))
+}
+
+// keepLease renova o lease do job periodicamente até ctx ser cancelado.
+// Se o lease for perdido, onLost é chamado.
+func (jp *JobProcessor) keepLease(ctx context.Context, jobID string, onLost func()) {
+	ticker := time.NewTicker(jp.cfg.JobLeaseDuration / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			ok, err := database.RenewLease(ctx, jp.db, jobID, jp.cfg.WorkerID, time.Now().Add(jp.cfg.JobLeaseDuration))
+			if err != nil {
+				log.Printf("Error renewing lease for job %s: %v", jobID, err)
+				continue
+			}
+			if !ok {
+				log.Printf("Lease lost for job %s, stopping", jobID)
+				onLost()
+				return
+			}
 		}
-		jobs = append(jobs, *job)
 	}
-
-	return jobs, nil
 }
 
-// processJob processa um job individual
+// processJob processa um job individual já reivindicado.
+// O job roda com prazo JobTimeout, derivado do contexto raiz do worker.
 func (jp *JobProcessor) processJob(ctx context.Context, job models.Job) {
 	log.Printf("Processing job %s (type: %s)", job.ID, job.Type)
 
-	// Atualizar status para PROCESSING
-	if err := jp.updateJobStatus(ctx, job.ID, "PROCESSING", nil, ""); err != nil {
-		log.Printf("Error updating job status: %v", err)
-		// Try again
-		time.Sleep(1 * time.Second)
-		if err := jp.updateJobStatus(ctx, job.ID, "PROCESSING", nil, ""); err != nil {
-			return
-		}
-	}
+	jobCtx, cancelTimeout := context.WithTimeoutCause(ctx, jp.cfg.JobTimeout, errJobTimeout)
+	defer cancelTimeout()
+	jobCtx, cancel := context.WithCancelCause(jobCtx)
+	defer cancel(nil)
+
+	// Manter o lease enquanto o job roda
+	leaseCtx, stopLease := context.WithCancel(jobCtx)
+	leaseDone := make(chan struct{})
+	go func() {
+		defer close(leaseDone)
+		jp.keepLease(leaseCtx, job.ID, func() { cancel(errLeaseLost) })
+	}()
+
+	jp.syncEmailExports(jobCtx, job, database.EmailExportUpdate{Status: database.EmailExportProcessing})
 
 	// Processar conforme tipo
 	var result map[string]interface{}
@@ -120,18 +261,68 @@ func (jp *JobProcessor) processJob(ctx context.Context, job models.Job) {
 
 	switch job.Type {
 	case "MANUAL", "MONTHLY_AUTO":
-		result, err = jp.processExportJob(ctx, job)
+		result, err = jp.processExportJob(jobCtx, job)
 	default:
 		err = fmt.Errorf("unknown job type: %s", job.Type)
 	}
 
-	// Atualizar status final
-	if err != nil {
-		log.Printf("Job %s failed: %v", job.ID, err)
-		jp.handleJobFailure(ctx, job, err)
-	} else {
+	// Parar a renovação antes de gravar o status final: uma renovação depois
+	// dele não acharia o lease e trataria o job concluído como perdido
+	stopLease()
+	<-leaseDone
+
+	// As atualizações finais não podem usar o contexto do job, que pode ter expirado
+	finalCtx, cancelFinal := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancelFinal()
+
+	if err == nil {
 		log.Printf("Job %s completed successfully", job.ID)
-		jp.updateJobStatus(ctx, job.ID, "COMPLETED", result, "")
+		if err := database.FinishJob(finalCtx, jp.db, job.ID, jp.cfg.WorkerID, "COMPLETED", result, ""); err != nil {
+			log.Printf("Error updating job status: %v", err)
+		}
+		// Registros que nenhum batch entregou nem registrou como falha do aluno
+		jp.syncEmailExports(finalCtx, job, database.EmailExportUpdate{
+			Status:       database.EmailExportFailed,
+			ErrorMessage: "aluno não incluído na exportação",
+		})
+		return
+	}
+
+	// Atualizar status final conforme o motivo da falha
+	quotaErr, quotaExceeded := IsQuotaExceeded(err)
+	switch cause := context.Cause(jobCtx); {
+	case errors.Is(cause, errLeaseLost):
+		// Outro worker é o dono do job agora, não gravar nada
+		log.Printf("Job %s aborted: %v", job.ID, cause)
+	case errors.Is(err, errJobCancelled) || jp.cancelRequested(finalCtx, job.ID):
+		log.Printf("Job %s cancelled: %v", job.ID, err)
+		if err := database.FinishJob(finalCtx, jp.db, job.ID, jp.cfg.WorkerID, "CANCELLED", result, err.Error()); err != nil {
+			log.Printf("Error updating job status: %v", err)
+		}
+		jp.syncEmailExports(finalCtx, job, database.EmailExportUpdate{
+			Status:       database.EmailExportFailed,
+			ErrorMessage: err.Error(),
+		})
+	case quotaExceeded:
+		// Cota do provedor esgotada: adiar sem contar tentativa; batches enviados são retomados
+		log.Printf("Job %s deferred until %s: %v", job.ID, quotaErr.ResetAt.Format(time.RFC3339), err)
+		if err := database.DeferJob(finalCtx, jp.db, job.ID, jp.cfg.WorkerID, quotaErr.ResetAt, err.Error()); err != nil {
+			log.Printf("Error deferring job: %v", err)
+		}
+		jp.syncEmailExports(finalCtx, job, database.EmailExportUpdate{Status: database.EmailExportPending})
+	case errors.Is(cause, errJobTimeout):
+		log.Printf("Job %s timed out after %v: %v", job.ID, jp.cfg.JobTimeout, err)
+		jp.handleJobFailure(finalCtx, job, fmt.Errorf("%w após %v: %v", errJobTimeout, jp.cfg.JobTimeout, err))
+	case ctx.Err() != nil:
+		// Worker encerrando: devolver o job à fila sem contar tentativa
+		log.Printf("Job %s interrupted by shutdown, releasing", job.ID)
+		if err := database.ReleaseJob(finalCtx, jp.db, job.ID, jp.cfg.WorkerID); err != nil {
+			log.Printf("Error releasing job: %v", err)
+		}
+		jp.syncEmailExports(finalCtx, job, database.EmailExportUpdate{Status: database.EmailExportPending})
+	default:
+		log.Printf("Job %s failed: %v", job.ID, err)
+		jp.handleJobFailure(finalCtx, job, err)
 	}
 }
 
@@ -149,26 +340,58 @@ func (jp *JobProcessor) processExportJob(ctx context.Context, job models.Job) (m
 		payload.BatchSize = jp.cfg.BatchSize
 	}
 
-	// Buscar usuários do banco
-	users, err := jp.fetchUsers(ctx, payload.UserIDs)
+	if payload.DeliveryMode == "" {
+		payload.DeliveryMode = models.DeliveryModeBatch
+	}
+
+	// Buscar usuários do banco (lista fixada na primeira tentativa)
+	targetIDs, users, err := jp.jobTargets(ctx, job, payload)
 	if err != nil {
 		return nil, fmt.Errorf("error fetching users: %w", err)
 	}
 
 	log.Printf("Job %s: fetched %d users", job.ID, len(users))
 
+	userIDs := make([]string, len(users))
+	for i, user := range users {
+		userIDs[i] = user.ID
+	}
+
 	// Buscar transações
-	transactionsMap, err := jp.fetchTransactions(ctx, payload.UserIDs, payload.StartDate, payload.EndDate)
+	transactionsMap, err := jp.fetchTransactions(ctx, userIDs, payload.StartDate, payload.EndDate)
 	if err != nil {
 		return nil, fmt.Errorf("error fetching transactions: %w", err)
 	}
 
 	// Dividir em batches
-	batches := jp.divideIntoBatches(users, payload.BatchSize)
+	batches := jp.divideIntoBatches(targetIDs, users, payload.BatchSize)
 	log.Printf("Job %s: %d users divided into %d batches", job.ID, len(users), len(batches))
 
+	// Progresso de tentativas anteriores: batches enviados e alunos já atendidos
+	progress, err := jp.fetchBatchProgress(ctx, job.ID, len(batches))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching batches: %w", err)
+	}
+	sentBatches := make(map[int]bool)
+	for number, b := range progress {
+		if b.EmailSent {
+			sentBatches[number] = true
+		}
+	}
+	if len(sentBatches) > 0 {
+		log.Printf("Job %s: resuming, %d/%d batches already sent", job.ID, len(sentBatches), len(batches))
+	}
+
+	// Textos do email conforme a origem do job (manual, mensal ou agendamento)
+	exportType := emailExportType(job.Type, payload)
+
+	// Uma conexão de envio para todo o job
+	session := OpenSession(jp.mailer)
+	defer session.Close()
+
 	// Processar cada batch
 	batchResults := make([]map[string]interface{}, 0)
+	batchesSent := 0
 
 	for i, batch := range batches {
 		batchInfo := BatchInfo{
@@ -177,9 +400,87 @@ func (jp *JobProcessor) processExportJob(ctx context.Context, job models.Job) (m
 			BatchID:      job.ID,
 		}
 
+		// Não reenviar batches concluídos
+		if sentBatches[batchInfo.BatchNumber] {
+			batchesSent++
+			batchResults = append(batchResults, map[string]interface{}{
+				"batch_number":     batchInfo.BatchNumber,
+				"recipients_count": len(batch),
+				"email_sent":       true,
+				"resumed":          true,
+			})
+			continue
+		}
+
+		// Todos os alunos do batch foram removidos desde a primeira tentativa
+		if len(batch) == 0 {
+			batchesSent++
+			batchResults = append(batchResults, map[string]interface{}{
+				"batch_number":     batchInfo.BatchNumber,
+				"recipients_count": 0,
+				"email_sent":       false,
+				"skipped":          true,
+			})
+			continue
+		}
+
+		// Parar entre batches se o cancelamento foi pedido
+		if jp.cancelRequested(ctx, job.ID) {
+			return map[string]interface{}{
+				"cancelled":     true,
+				"total_users":   len(users),
+				"total_batches": len(batches),
+				"batches_sent":  batchesSent,
+				"delivery_mode": payload.DeliveryMode,
+				"batch_results": batchResults,
+			}, fmt.Errorf("%w após %d/%d batches", errJobCancelled, batchesSent, len(batches))
+		}
+
+		// No modo RECIPIENT, alunos atendidos em tentativas anteriores não recebem de novo
+		prior := progress[batchInfo.BatchNumber]
+		pending := batch
+		if payload.DeliveryMode == models.DeliveryModeRecipient {
+			pending = pendingRecipients(batch, prior)
+		}
+
+		// Reservar na cota diária os envios do batch (ou o que resta dela) antes
+		// de começar; quando a cota acaba, o job é adiado até a virada do dia e
+		// retoma dos alunos ainda não atendidos
+		emailsNeeded := 1
+		if payload.DeliveryMode == models.DeliveryModeRecipient {
+			emailsNeeded = len(pending)
+		}
+		reservation, err := jp.limiter.Reserve(ctx, emailsNeeded)
+		if err != nil {
+			return nil, fmt.Errorf("batch %d: %w", i+1, err)
+		}
+		batchSession := limitedSession{session, jp.limiter, reservation}
+
+		// Registrar início do batch
+		record := &models.Batch{
+			ID:              batchRecordID(job.ID, batchInfo.BatchNumber),
+			JobID:           job.ID,
+			BatchNumber:     batchInfo.BatchNumber,
+			TotalBatches:    batchInfo.TotalBatches,
+			Status:          "PROCESSING",
+			RecipientsCount: len(batch),
+			SentUserIDs:     prior.SentUserIDs,
+			FailedUserIDs:   prior.FailedUserIDs,
+		}
+		jp.saveBatch(ctx, record)
+
 		// Gerar CSVs para o batch
-		csvResults := make([]CSVResult, 0, len(batch))
-		for _, user := range batch {
+		csvResults := make([]CSVResult, 0, len(pending))
+		for _, user := range pending {
+			if err := ctx.Err(); err != nil {
+				cleanupCSVs(csvResults)
+				reservation.Release(ctx)
+				record.Status = "FAILED"
+				record.ErrorMessage = err.Error()
+				jp.saveBatch(ctx, record)
+				return nil, fmt.Errorf("batch %d interrupted: %w", i+1, err)
+			}
+
 			transactions := transactionsMap[user.ID] // This will return nil/empty if not found, which is fine
 			csv, err := GenerateStudentCSV(user, transactions, payload.StartDate, payload.EndDate)
 			if err != nil {
@@ -189,37 +490,169 @@ func (jp *JobProcessor) processExportJob(ctx context.Context, job models.Job) (m
 			csvResults = append(csvResults, *csv)
 		}
 
-		// Enviar email
-		batchResult, err := SendBatchEmails(
-			jp.emailClient,
-			batch,
-			csvResults,
-			payload.ToEmail,
-			job.Type,
-			batchInfo,
-		)
+		// Enviar email(s) conforme o modo de entrega
+		var batchResult *BatchResult
+		if payload.DeliveryMode == models.DeliveryModeRecipient {
+			batchResult, err = SendRecipientEmails(
+				ctx,
+				batchSession,
+				pending,
+				csvResults,
+				exportType,
+				batchInfo,
+				payload.StartDate,
+				payload.EndDate,
+			)
+		} else {
+			batchResult, err = SendBatchEmails(
+				ctx,
+				batchSession,
+				batch,
+				csvResults,
+				payload.ToEmail,
+				exportType,
+				batchInfo,
+			)
+		}
+
+		// Envios reservados e não feitos (falhas, interrupção) voltam para a cota
+		reservation.Release(ctx)
+
+		if batchResult != nil {
+			record.ErrorMessage = strings.Join(batchResult.Errors, "; ")
+			if payload.DeliveryMode == models.DeliveryModeRecipient {
+				record.SentUserIDs = append(record.SentUserIDs, batchResult.SentUserIDs...)
+				for _, f := range batchResult.Failures {
+					record.FailedUserIDs = append(record.FailedUserIDs, f.UserID)
+				}
+			}
+		}
 
 		if err != nil {
+			// Alunos que já receberam o email no envio parcial
+			jp.syncSentBatch(ctx, job, batchInfo, batchResult)
+			jp.syncFailedRecipients(ctx, job, batchInfo, batchResult)
+
+			record.Status = "FAILED"
+			if record.ErrorMessage == "" {
+				record.ErrorMessage = err.Error()
+			}
+			jp.saveBatch(ctx, record)
 			return nil, fmt.Errorf("error sending batch %d: %w", i+1, err)
 		}
 
+		record.Status = "SENT"
+		record.EmailSent = true
+		record.SentAt = database.FormatTime(time.Now())
+		jp.saveBatch(ctx, record)
+		batchesSent++
+		jp.syncSentBatch(ctx, job, batchInfo, batchResult)
+		jp.syncFailedRecipients(ctx, job, batchInfo, batchResult)
+
 		batchResults = append(batchResults, map[string]interface{}{
-			"batch_number":     batchResult.BatchNumber,
-			"recipients_count": batchResult.RecipientsCount,
-			"email_sent":       batchResult.EmailSent,
+			"batch_number":      batchResult.BatchNumber,
+			"recipients_count":  len(batch),
+			"email_sent":        batchResult.EmailSent,
+			"emails_sent":       batchResult.EmailsSent,
+			"failed_recipients": len(batchResult.Failures),
 		})
 	}
 
 	return map[string]interface{}{
-		"total_users":   len(users),
-		"total_batches": len(batches),
-		"batch_results": batchResults,
+		"total_users":     len(users),
+		"total_batches":   len(batches),
+		"resumed_batches": len(sentBatches),
+		"delivery_mode":   payload.DeliveryMode,
+		"batch_results":   batchResults,
 	}, nil
 }
 
-// fetchUsers busca usuários do banco
-func (jp *JobProcessor) fetchUsers(ctx context.Context, userIDs []string) ([]models.User, error) {
-	return database.GetUsers(ctx, jp.db, userIDs)
+// jobTargets retorna os IDs alvo do job, em ordem, e os usuários encontrados.
+// A primeira tentativa resolve o payload e grava a lista; os retries a reutilizam,
+// para que mudanças de turma ou consentimento não troquem alunos de batch.
+func (jp *JobProcessor) jobTargets(ctx context.Context, job models.Job, payload models.ExportJobPayload) ([]string, []models.User, error) {
+	targetIDs, found, err := database.GetJobTargets(ctx, jp.db, job.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if found {
+		users, err := database.GetUsers(ctx, jp.db, targetIDs)
+		if err != nil {
+			return nil, nil, err
+		}
+		if missing := len(targetIDs) - len(users); missing > 0 {
+			log.Printf("Job %s: %d target users no longer exist", job.ID, missing)
+		}
+		return targetIDs, users, nil
+	}
+
+	users, err := jp.resolveUsers(ctx, payload)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	targetIDs = make([]string, len(users))
+	for i, user := range users {
+		targetIDs[i] = user.ID
+	}
+	if err := database.SaveJobTargets(ctx, jp.db, job.ID, targetIDs); err != nil {
+		return nil, nil, fmt.Errorf("error saving job targets: %w", err)
+	}
+
+	return targetIDs, users, nil
+}
+
+// resolveUsers busca os usuários alvo do payload.
+// UserIDs e turmas são combinados (união, sem repetição).
+func (jp *JobProcessor) resolveUsers(ctx context.Context, payload models.ExportJobPayload) ([]models.User, error) {
+	if payload.AllConsenting {
+		return database.GetConsentingStudents(ctx, jp.db)
+	}
+
+	users, err := database.GetUsers(ctx, jp.db, payload.UserIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	// turma_name legado é apenas rótulo quando user_ids foi enviado
+	turmaNames := append([]string{}, payload.TurmaNames...)
+	if payload.TurmaName != "" && len(payload.UserIDs) == 0 {
+		turmaNames = append(turmaNames, payload.TurmaName)
+	}
+
+	if len(payload.TurmaIDs) == 0 && len(turmaNames) == 0 {
+		return users, nil
+	}
+
+	turmaUsers, err := database.GetStudentsByTurmas(ctx, jp.db, payload.TurmaIDs, turmaNames)
+	if err != nil {
+		return nil, err
+	}
+
+	return mergeUsers(users, turmaUsers), nil
+}
+
+// mergeUsers une listas de usuários sem repetição, ordenadas por ID
+func mergeUsers(lists ...[]models.User) []models.User {
+	seen := make(map[string]bool)
+	merged := []models.User{}
+
+	for _, list := range lists {
+		for _, user := range list {
+			if seen[user.ID] {
+				continue
+			}
+			seen[user.ID] = true
+			merged = append(merged, user)
+		}
+	}
+
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].ID < merged[j].ID
+	})
+
+	return merged
 }
 
 // fetchTransactions busca transações do banco
@@ -227,49 +660,129 @@ func (jp *JobProcessor) fetchTransactions(ctx context.Context, userIDs []string,
 	return database.GetTransactions(ctx, jp.db, userIDs, startDate, endDate)
 }
 
-// divideIntoBatches divide usuários em batches
-func (jp *JobProcessor) divideIntoBatches(users []models.User, batchSize int) [][]models.User {
+// fetchBatchProgress retorna os registros de batch do job por número.
+// Registros de uma divisão diferente (total de batches mudou) são ignorados.
+func (jp *JobProcessor) fetchBatchProgress(ctx context.Context, jobID string, totalBatches int) (map[int]models.Batch, error) {
+	records, err := database.GetJobBatches(ctx, jp.db, jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	progress := make(map[int]models.Batch)
+	for _, b := range records {
+		if b.TotalBatches == totalBatches {
+			progress[b.BatchNumber] = b
+		}
+	}
+
+	return progress, nil
+}
+
+// pendingRecipients retorna os alunos do batch ainda não atendidos
+// (enviados ou com falha definitiva) em tentativas anteriores
+func pendingRecipients(batch []models.User, prior models.Batch) []models.User {
+	done := make(map[string]bool, len(prior.SentUserIDs)+len(prior.FailedUserIDs))
+	for _, id := range prior.SentUserIDs {
+		done[id] = true
+	}
+	for _, id := range prior.FailedUserIDs {
+		done[id] = true
+	}
+
+	pending := make([]models.User, 0, len(batch))
+	for _, user := range batch {
+		if !done[user.ID] {
+			pending = append(pending, user)
+		}
+	}
+	return pending
+}
+
+// batchRecordID gera o ID determinístico do registro de um batch
+func batchRecordID(jobID string, batchNumber int) string {
+	return fmt.Sprintf("%s_batch_%d", jobID, batchNumber)
+}
+
+// saveBatch persiste o progresso de um batch em export_batches
+func (jp *JobProcessor) saveBatch(ctx context.Context, batch *models.Batch) {
+	// Gravar o progresso mesmo que o contexto do job tenha expirado
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+
+	if err := database.SaveBatch(ctx, jp.db, batch); err != nil {
+		log.Printf("Error saving batch %s: %v", batch.ID, err)
+	}
+}
+
+// divideIntoBatches divide os IDs alvo em batches e os preenche com os usuários
+// encontrados. Usuários removidos saem do seu batch sem deslocar os demais.
+func (jp *JobProcessor) divideIntoBatches(targetIDs []string, users []models.User, batchSize int) [][]models.User {
+	byID := make(map[string]models.User, len(users))
+	for _, user := range users {
+		byID[user.ID] = user
+	}
+
 	var batches [][]models.User
 
-	for i := 0; i < len(users); i += batchSize {
+	for i := 0; i < len(targetIDs); i += batchSize {
 		end := i + batchSize
-		if end > len(users) {
-			end = len(users)
+		if end > len(targetIDs) {
+			end = len(targetIDs)
+		}
+
+		batch := make([]models.User, 0, end-i)
+		for _, id := range targetIDs[i:end] {
+			if user, ok := byID[id]; ok {
+				batch = append(batch, user)
+			}
 		}
-		batches = append(batches, users[i:end])
+		batches = append(batches, batch)
 	}
 
 	return batches
 }
 
-// updateJobStatus atualiza status de um job no banco
-func (jp *JobProcessor) updateJobStatus(ctx context.Context, jobID, status string, result map[string]interface{}, errorMessage string) error {
-	var resultJSON sql.NullString
-	var startedAt, completedAt string
-
-	if status == "PROCESSING" {
-		startedAt = time.Now().Format(time.RFC3339)
-	} else if status == "COMPLETED" || status == "FAILED" {
-		completedAt = time.Now().Format(time.RFC3339)
+// syncSentBatch marca como SENT os registros EmailExport dos alunos entregues no batch
+func (jp *JobProcessor) syncSentBatch(ctx context.Context, job models.Job, batchInfo BatchInfo, result *BatchResult) {
+	if result == nil || len(result.SentUserIDs) == 0 {
+		return
 	}
 
-	if result != nil {
-		resultBytes, _ := json.Marshal(result)
-		resultJSON = sql.NullString{String: string(resultBytes), Valid: true}
+	jp.syncEmailExports(ctx, job, database.EmailExportUpdate{
+		Status:       database.EmailExportSent,
+		UserIDs:      result.SentUserIDs,
+		BatchNumber:  batchInfo.BatchNumber,
+		TotalBatches: batchInfo.TotalBatches,
+	})
+}
+
+// syncFailedRecipients marca como FAILED, com o motivo, os registros EmailExport
+// dos alunos com falha definitiva no batch (modo RECIPIENT)
+func (jp *JobProcessor) syncFailedRecipients(ctx context.Context, job models.Job, batchInfo BatchInfo, result *BatchResult) {
+	if result == nil {
+		return
 	}
 
-	query := `
-		UPDATE export_jobs
-		SET status = ?,
-		    started_at = COALESCE(?, started_at),
-		    completed_at = ?,
-		    result = ?,
-		    error_message = ?
-		WHERE id = ?
-	`
+	for _, f := range result.Failures {
+		jp.syncEmailExports(ctx, job, database.EmailExportUpdate{
+			Status:       database.EmailExportFailed,
+			UserIDs:      []string{f.UserID},
+			BatchNumber:  batchInfo.BatchNumber,
+			TotalBatches: batchInfo.TotalBatches,
+			ErrorMessage: f.Reason,
+		})
+	}
+}
 
-	_, err := jp.db.ExecContext(ctx, query, status, startedAt, completedAt, resultJSON, errorMessage, jobID)
-	return err
+// cancelRequested consulta se o cancelamento do job foi pedido.
+// Erros de leitura são tratados como "não pedido" para não interromper o job.
+func (jp *JobProcessor) cancelRequested(ctx context.Context, jobID string) bool {
+	requested, err := database.IsCancelRequested(ctx, jp.db, jobID)
+	if err != nil {
+		log.Printf("Error checking cancellation for job %s: %v", jobID, err)
+		return false
+	}
+	return requested
 }
 
 // handleJobFailure trata falha de job com retry
@@ -278,17 +791,28 @@ func (jp *JobProcessor) handleJobFailure(ctx context.Context, job models.Job, er
 
 	if retryCount >= job.MaxRetries {
 		// Marcar como FAILED permanentemente
-		jp.updateJobStatus(ctx, job.ID, "FAILED", nil, err.Error())
-	} else {
-		// Marcar como PENDING para retry
-		lastRetryAt := time.Now().Format(time.RFC3339)
-		query := `
-			UPDATE export_jobs
-			SET status = 'PENDING',
-			    retry_count = ?,
-			    last_retry_at = ?
-			WHERE id = ?
-		`
-		jp.db.ExecContext(ctx, query, retryCount, lastRetryAt, job.ID)
+		if err := database.FailJob(ctx, jp.db, job.ID, jp.cfg.WorkerID, retryCount, err.Error()); err != nil {
+			log.Printf("Error updating job status: %v", err)
+		}
+		jp.syncEmailExports(ctx, job, database.EmailExportUpdate{
+			Status:       database.EmailExportFailed,
+			RetryCount:   &retryCount,
+			ErrorMessage: err.Error(),
+		})
+		return
+	}
+
+	// Marcar como PENDING para retry após o backoff
+	delay := jp.retryPolicy(job.Type).NextDelay(retryCount)
+	if err := database.RequeueJob(ctx, jp.db, job.ID, jp.cfg.WorkerID, retryCount, time.Now().Add(delay), err.Error()); err != nil {
+		log.Printf("Error requeuing job: %v", err)
+		return
 	}
+	jp.syncEmailExports(ctx, job, database.EmailExportUpdate{
+		Status:       database.EmailExportRetrying,
+		RetryCount:   &retryCount,
+		ErrorMessage: err.Error(),
+	})
+
+	log.Printf("Job %s requeued, retry %d/%d in %v", job.ID, retryCount, job.MaxRetries, delay.Round(time.Second))
 }
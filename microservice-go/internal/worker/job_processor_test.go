@@ -0,0 +1,246 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"educasa/internal/config"
+	"educasa/internal/database"
+	"educasa/internal/models"
+)
+
+// webAppTables cria as tabelas do web-app lidas pelo worker, com as colunas do schema Prisma
+const webAppTables = `
+	CREATE TABLE turmas (id TEXT PRIMARY KEY, name TEXT NOT NULL, createdAt DATETIME, updatedAt DATETIME);
+	CREATE TABLE users (
+		id TEXT PRIMARY KEY, email TEXT NOT NULL, password TEXT, name TEXT NOT NULL, role TEXT NOT NULL,
+		turmaId TEXT, autoExportConsent BOOLEAN NOT NULL DEFAULT 0, createdAt DATETIME, updatedAt DATETIME
+	);
+	CREATE TABLE categories (id TEXT PRIMARY KEY, name TEXT NOT NULL, type TEXT NOT NULL);
+	CREATE TABLE subcategories (id TEXT PRIMARY KEY, name TEXT NOT NULL, categoryId TEXT NOT NULL);
+	CREATE TABLE transactions (
+		id TEXT PRIMARY KEY, description TEXT NOT NULL, amount REAL NOT NULL, type TEXT NOT NULL, date DATETIME NOT NULL,
+		userId TEXT NOT NULL, categoryId TEXT, subcategoryId TEXT, createdAt DATETIME, updatedAt DATETIME
+	);
+	CREATE TABLE email_exports (
+		id TEXT PRIMARY KEY, userId TEXT NOT NULL, userEmail TEXT NOT NULL, userName TEXT NOT NULL,
+		type TEXT NOT NULL DEFAULT 'MANUAL', status TEXT NOT NULL DEFAULT 'PENDING',
+		startDate DATETIME NOT NULL, endDate DATETIME NOT NULL, batchId TEXT, batchNumber INTEGER, totalBatches INTEGER,
+		recipientsCount INTEGER NOT NULL, toEmail TEXT NOT NULL, subject TEXT NOT NULL, attachmentPath TEXT,
+		createdAt DATETIME, sentAt DATETIME, failedAt DATETIME, errorMessage TEXT,
+		retryCount INTEGER NOT NULL DEFAULT 0, lastRetryAt DATETIME
+	);
+`
+
+// openExportDB abre um banco com o schema do worker, as tabelas do web-app e três alunos
+// (u2 sem email), cada um com uma transação e um registro EmailExport do job job_1
+func openExportDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db := openQuotaDB(t)
+	for _, stmt := range strings.Split(webAppTables, ";") {
+		if strings.TrimSpace(stmt) == "" {
+			continue
+		}
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	seed := []string{
+		`INSERT INTO turmas (id, name) VALUES ('t1', 'Turma A')`,
+		`INSERT INTO categories (id, name, type) VALUES ('c1', 'Alimentação', 'EXPENSE')`,
+		`INSERT INTO users (id, email, name, role, turmaId, createdAt, updatedAt) VALUES
+			('u1', 'aluno1@escola.com', 'Aluno Um', 'STUDENT', 't1', '2025-01-01 00:00:00', '2025-01-01 00:00:00'),
+			('u2', '', 'Aluno Dois', 'STUDENT', 't1', '2025-01-01 00:00:00', '2025-01-01 00:00:00'),
+			('u3', 'aluno3@escola.com', 'Aluno Tres', 'STUDENT', 't1', '2025-01-01 00:00:00', '2025-01-01 00:00:00')`,
+		`INSERT INTO transactions (id, description, amount, type, date, userId, categoryId, createdAt, updatedAt)
+			SELECT 'tx_' || id, 'Lanche', 12.5, 'EXPENSE', '2025-01-15 12:00:00', id, 'c1', '2025-01-15 12:00:00', '2025-01-15 12:00:00' FROM users`,
+		`INSERT INTO email_exports (id, userId, userEmail, userName, startDate, endDate, batchId, recipientsCount, toEmail, subject)
+			SELECT 'ee_' || id, id, email, name, 0, 0, 'job_1', 3, email, 'Relatório' FROM users`,
+	}
+	for _, stmt := range seed {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func TestProcessExportJobOutbox(t *testing.T) {
+	tests := []struct {
+		name          string
+		deliveryMode  string
+		wantTo        []string          // Destinatário de cada .eml, em ordem
+		wantCSVs      []int             // Anexos de cada .eml, na mesma ordem
+		wantSent      map[int][]string  // sent_user_ids por batch (modo RECIPIENT)
+		wantFailed    map[int][]string  // failed_user_ids por batch (modo RECIPIENT)
+		wantExports   map[string]string // Status de email_exports por aluno
+		wantExportErr map[string]string // errorMessage de email_exports por aluno
+	}{
+		{
+			name:         "um email por aluno",
+			deliveryMode: models.DeliveryModeRecipient,
+			wantTo:       []string{"aluno1@escola.com", "aluno3@escola.com"},
+			wantCSVs:     []int{1, 1},
+			wantSent:     map[int][]string{1: {"u1"}, 2: {"u3"}},
+			wantFailed:   map[int][]string{1: {"u2"}},
+			wantExports:  map[string]string{"u1": "SENT", "u2": "FAILED", "u3": "SENT"},
+			wantExportErr: map[string]string{
+				"u2": "Aluno u2 sem email",
+			},
+		},
+		{
+			name:         "um email por batch",
+			deliveryMode: models.DeliveryModeBatch,
+			wantTo:       []string{"secretaria@escola.com", "secretaria@escola.com"},
+			wantCSVs:     []int{2, 1},
+			wantExports:  map[string]string{"u1": "SENT", "u2": "SENT", "u3": "SENT"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			db := openExportDB(t)
+
+			dir := filepath.Join(t.TempDir(), "outbox")
+			outbox, err := NewOutboxMailer(dir, "noreply@educasa.app.br", "Educa.SA")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = db.Exec(`INSERT INTO export_jobs (id, type, payload) VALUES ('job_1', 'MANUAL', ?)`,
+				`{"user_ids":["u1","u2","u3"],"delivery_mode":"`+tt.deliveryMode+`","batch_size":2,`+
+					`"to_email":"secretaria@escola.com","start_date":"2025-01-01T00:00:00Z","end_date":"2025-01-31T23:59:59Z"}`)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			jp := NewJobProcessor(db, outbox, &config.Config{
+				WorkerID:         "worker-a",
+				JobLeaseDuration: time.Minute,
+				JobTimeout:       time.Minute,
+				BatchSize:        50,
+				RetryBaseDelay:   time.Second,
+				RetryMaxDelay:    time.Minute,
+			})
+
+			if claimed, err := jp.claimJob(ctx, "job_1"); err != nil || !claimed {
+				t.Fatalf("claimJob = %v, %v", claimed, err)
+			}
+			job, err := database.GetJob(ctx, db, "job_1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			jp.processJob(ctx, *job)
+
+			// Job concluído com o resumo dos batches
+			job, err = database.GetJob(ctx, db, "job_1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if job.Status != "COMPLETED" || job.LeaseOwner != nil {
+				t.Fatalf("status = %s, lease_owner = %v, erro = %v; esperado COMPLETED sem lease", job.Status, job.LeaseOwner, job.ErrorMessage)
+			}
+			if job.Result["total_users"] != float64(3) || job.Result["total_batches"] != float64(2) {
+				t.Errorf("result = %v", job.Result)
+			}
+
+			// Emails gravados na outbox (nomes começam pelo horário do envio)
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			names := make([]string, 0, len(entries))
+			for _, e := range entries {
+				names = append(names, e.Name())
+			}
+			sort.Strings(names)
+			if len(names) != len(tt.wantTo) {
+				t.Fatalf("%d emails na outbox, esperado %d: %v", len(names), len(tt.wantTo), names)
+			}
+			for i, name := range names {
+				raw, err := os.ReadFile(filepath.Join(dir, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				msg, _, parts := parseMessage(t, raw)
+
+				to, err := mail.ParseAddress(msg.Header.Get("To"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if to.Address != tt.wantTo[i] {
+					t.Errorf("email %d: To = %s, esperado %s", i+1, to.Address, tt.wantTo[i])
+				}
+
+				csvs := 0
+				for _, p := range parts {
+					if strings.HasSuffix(p.filename, ".csv") {
+						csvs++
+						if !strings.Contains(string(p.body), "Lanche") {
+							t.Errorf("email %d: CSV %s sem a transação do aluno", i+1, p.filename)
+						}
+					}
+				}
+				if csvs != tt.wantCSVs[i] {
+					t.Errorf("email %d: %d CSVs anexados, esperado %d", i+1, csvs, tt.wantCSVs[i])
+				}
+			}
+
+			// Batches enviados, com os alunos atendidos e as falhas de cada um
+			batches, err := database.GetJobBatches(ctx, db, "job_1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(batches) != 2 {
+				t.Fatalf("%d batches, esperado 2", len(batches))
+			}
+			for _, b := range batches {
+				if b.Status != "SENT" || !b.EmailSent {
+					t.Errorf("batch %d: status = %s, email_sent = %v", b.BatchNumber, b.Status, b.EmailSent)
+				}
+				if strings.Join(b.SentUserIDs, ",") != strings.Join(tt.wantSent[b.BatchNumber], ",") {
+					t.Errorf("batch %d: sent_user_ids = %v, esperado %v", b.BatchNumber, b.SentUserIDs, tt.wantSent[b.BatchNumber])
+				}
+				if strings.Join(b.FailedUserIDs, ",") != strings.Join(tt.wantFailed[b.BatchNumber], ",") {
+					t.Errorf("batch %d: failed_user_ids = %v, esperado %v", b.BatchNumber, b.FailedUserIDs, tt.wantFailed[b.BatchNumber])
+				}
+			}
+
+			// Registros EmailExport do web-app
+			rows, err := db.Query(`SELECT userId, status, COALESCE(errorMessage, ''), sentAt IS NOT NULL, failedAt IS NOT NULL FROM email_exports`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rows.Close()
+			for rows.Next() {
+				var userID, status, errorMessage string
+				var sentAt, failedAt bool
+				if err := rows.Scan(&userID, &status, &errorMessage, &sentAt, &failedAt); err != nil {
+					t.Fatal(err)
+				}
+				if status != tt.wantExports[userID] {
+					t.Errorf("email_exports %s: status = %s, esperado %s", userID, status, tt.wantExports[userID])
+				}
+				if errorMessage != tt.wantExportErr[userID] {
+					t.Errorf("email_exports %s: errorMessage = %q, esperado %q", userID, errorMessage, tt.wantExportErr[userID])
+				}
+				if sentAt != (status == "SENT") || failedAt != (status == "FAILED") {
+					t.Errorf("email_exports %s: sentAt = %v, failedAt = %v com status %s", userID, sentAt, failedAt, status)
+				}
+			}
+			if err := rows.Err(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
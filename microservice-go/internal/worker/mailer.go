@@ -0,0 +1,51 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+
+	"educasa/internal/config"
+)
+
+// Backends de envio aceitos em MAIL_BACKEND
+const (
+	MailBackendSMTP   = "smtp"
+	MailBackendOutbox = "outbox"
+	MailBackendHTTP   = "http"
+)
+
+// Mailer envia um email e retorna o identificador da mensagem
+type Mailer interface {
+	SendEmail(ctx context.Context, req EmailRequest) (messageID string, err error)
+}
+
+// NewMailer cria o backend de envio configurado em MAIL_BACKEND
+func NewMailer(cfg *config.Config) (Mailer, error) {
+	switch cfg.MailBackend {
+	case MailBackendSMTP:
+		client := NewSMTPClient(
+			cfg.SMTPHost,
+			cfg.SMTPPort,
+			cfg.SMTPUsername,
+			cfg.SMTPPassword,
+			cfg.SMTPFromEmail,
+			cfg.SMTPFromName,
+		)
+		client.TLSMode = cfg.SMTPTLSMode
+		client.AuthMechanism = cfg.SMTPAuthMechanism
+		if cfg.SMTPCAFile != "" {
+			pool, err := LoadCAFile(cfg.SMTPCAFile)
+			if err != nil {
+				return nil, err
+			}
+			client.RootCAs = pool
+		}
+		return client, nil
+	case MailBackendOutbox:
+		return NewOutboxMailer(cfg.MailOutboxDir, cfg.SMTPFromEmail, cfg.SMTPFromName)
+	case MailBackendHTTP:
+		return NewHTTPMailer(cfg.MailAPIURL, cfg.MailAPIToken, cfg.SMTPFromEmail, cfg.SMTPFromName, cfg.MailAPITimeout), nil
+	default:
+		return nil, fmt.Errorf("backend de email desconhecido: %s", cfg.MailBackend)
+	}
+}
@@ -0,0 +1,191 @@
+package worker
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// mimeLineLength é o limite de caracteres por linha do base64 (RFC 2045)
+const mimeLineLength = 76
+
+// defaultAttachmentType é usado quando o anexo não informa ContentType
+const defaultAttachmentType = "application/octet-stream"
+
+// buildMessage monta a mensagem MIME e o Message-ID usados por SMTP e outbox.
+//
+// Estrutura:
+//
+//	multipart/mixed
+//	├── multipart/alternative (text/plain + text/html)
+//	└── anexos em base64
+//
+// Sem anexos, multipart/alternative é a raiz.
+func buildMessage(fromEmail, fromName string, req EmailRequest) (messageID string, message []byte, err error) {
+	messageID = fmt.Sprintf("<%d@educasa.app.br>", time.Now().UnixNano())
+
+	var msg bytes.Buffer
+
+	// Headers (nomes e assunto com acentos vão como encoded-words da RFC 2047)
+	from := mail.Address{Name: fromName, Address: fromEmail}
+	to := mail.Address{Address: req.To}
+	writeHeader(&msg, "Message-ID", messageID)
+	writeHeader(&msg, "Date", time.Now().Format(time.RFC1123Z))
+	writeHeader(&msg, "From", from.String())
+	writeHeader(&msg, "To", to.String())
+	writeHeader(&msg, "Subject", mime.QEncoding.Encode("UTF-8", req.Subject))
+	writeHeader(&msg, "MIME-Version", "1.0")
+
+	text := req.Text
+	if text == "" {
+		text = htmlToText(req.HTML)
+	}
+
+	if len(req.Attachments) == 0 {
+		alternative := multipart.NewWriter(&msg)
+		writeHeader(&msg, "Content-Type", mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": alternative.Boundary()}))
+		msg.WriteString("\r\n")
+		if err := writeAlternative(alternative, text, req.HTML); err != nil {
+			return "", nil, err
+		}
+		return messageID, msg.Bytes(), nil
+	}
+
+	mixed := multipart.NewWriter(&msg)
+	writeHeader(&msg, "Content-Type", mime.FormatMediaType("multipart/mixed", map[string]string{"boundary": mixed.Boundary()}))
+	msg.WriteString("\r\n")
+
+	// Corpo: text e HTML aninhados em multipart/alternative
+	boundary := multipart.NewWriter(io.Discard).Boundary()
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": boundary}))
+	body, err := mixed.CreatePart(header)
+	if err != nil {
+		return "", nil, err
+	}
+	alternative := multipart.NewWriter(body)
+	if err := alternative.SetBoundary(boundary); err != nil {
+		return "", nil, err
+	}
+	if err := writeAlternative(alternative, text, req.HTML); err != nil {
+		return "", nil, err
+	}
+
+	// Anexos
+	for _, att := range req.Attachments {
+		if err := writeAttachment(mixed, att); err != nil {
+			return "", nil, fmt.Errorf("erro ao anexar %s: %w", att.Filename, err)
+		}
+	}
+
+	if err := mixed.Close(); err != nil {
+		return "", nil, err
+	}
+
+	return messageID, msg.Bytes(), nil
+}
+
+// writeAlternative escreve as partes text/plain e text/html e fecha o writer
+func writeAlternative(w *multipart.Writer, text, htmlBody string) error {
+	parts := []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain; charset=UTF-8", text},
+		{"text/html; charset=UTF-8", htmlBody},
+	}
+
+	for _, p := range parts {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", p.contentType)
+		header.Set("Content-Transfer-Encoding", "quoted-printable")
+
+		part, err := w.CreatePart(header)
+		if err != nil {
+			return err
+		}
+		qp := quotedprintable.NewWriter(part)
+		if _, err := qp.Write([]byte(p.body)); err != nil {
+			return err
+		}
+		if err := qp.Close(); err != nil {
+			return err
+		}
+	}
+
+	return w.Close()
+}
+
+// writeAttachment escreve um anexo em base64 com linhas de no máximo 76 caracteres
+func writeAttachment(w *multipart.Writer, att EmailAttachment) error {
+	contentType := att.ContentType
+	if contentType == "" {
+		contentType = defaultAttachmentType
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("content type inválido: %w", err)
+	}
+	params["name"] = att.Filename
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", mime.FormatMediaType(mediaType, params))
+	header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": att.Filename}))
+	header.Set("Content-Transfer-Encoding", "base64")
+
+	part, err := w.CreatePart(header)
+	if err != nil {
+		return err
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(att.Content)
+	for len(encoded) > mimeLineLength {
+		if _, err := fmt.Fprintf(part, "%s\r\n", encoded[:mimeLineLength]); err != nil {
+			return err
+		}
+		encoded = encoded[mimeLineLength:]
+	}
+	_, err = fmt.Fprintf(part, "%s\r\n", encoded)
+	return err
+}
+
+// writeHeader escreve um campo de cabeçalho terminado em CRLF
+func writeHeader(buf *bytes.Buffer, name, value string) {
+	buf.WriteString(name)
+	buf.WriteString(": ")
+	buf.WriteString(value)
+	buf.WriteString("\r\n")
+}
+
+var (
+	htmlBlockTags   = regexp.MustCompile(`(?i)<(br|/p|/div|/h[1-6]|/li|/tr)[^>]*>`)
+	htmlHiddenBlock = regexp.MustCompile(`(?is)<(style|script|head)[^>]*>.*?</(style|script|head)>`)
+	htmlTags        = regexp.MustCompile(`<[^>]*>`)
+	blankLines      = regexp.MustCompile(`\n{3,}`)
+)
+
+// htmlToText gera a alternativa text/plain a partir do HTML do email
+func htmlToText(htmlBody string) string {
+	text := htmlHiddenBlock.ReplaceAllString(htmlBody, "")
+	text = htmlBlockTags.ReplaceAllString(text, "\n")
+	text = htmlTags.ReplaceAllString(text, "")
+	text = html.UnescapeString(text)
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.Join(strings.Fields(line), " ")
+	}
+	text = strings.Join(lines, "\n")
+
+	return strings.TrimSpace(blankLines.ReplaceAllString(text, "\n\n"))
+}
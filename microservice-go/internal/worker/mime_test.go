@@ -0,0 +1,231 @@
+package worker
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+// parsedPart é uma parte folha da mensagem, já decodificada
+type parsedPart struct {
+	contentType string
+	filename    string
+	body        []byte
+}
+
+// parseMessage decodifica a mensagem e retorna a árvore de tipos e as partes folha
+func parseMessage(t *testing.T, raw []byte) (*mail.Message, []string, []parsedPart) {
+	t.Helper()
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("mensagem inválida: %v", err)
+	}
+
+	var types []string
+	var parts []parsedPart
+
+	var walk func(contentType string, body io.Reader, encoding, disposition string)
+	walk = func(contentType string, body io.Reader, encoding, disposition string) {
+		mediaType, params, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			t.Fatalf("Content-Type inválido %q: %v", contentType, err)
+		}
+		types = append(types, mediaType)
+
+		if strings.HasPrefix(mediaType, "multipart/") {
+			reader := multipart.NewReader(body, params["boundary"])
+			for {
+				part, err := reader.NextRawPart()
+				if err == io.EOF {
+					return
+				}
+				if err != nil {
+					t.Fatalf("erro ao ler parte de %s: %v", mediaType, err)
+				}
+				walk(part.Header.Get("Content-Type"), part, part.Header.Get("Content-Transfer-Encoding"), part.Header.Get("Content-Disposition"))
+			}
+		}
+
+		raw, err := io.ReadAll(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var decoded []byte
+		switch encoding {
+		case "base64":
+			for _, line := range strings.Split(strings.TrimRight(string(raw), "\r\n"), "\r\n") {
+				if len(line) > mimeLineLength {
+					t.Errorf("linha base64 com %d caracteres (máximo %d)", len(line), mimeLineLength)
+				}
+			}
+			decoded, err = base64.StdEncoding.DecodeString(strings.ReplaceAll(string(raw), "\r\n", ""))
+		case "quoted-printable":
+			decoded, err = io.ReadAll(quotedprintable.NewReader(bytes.NewReader(raw)))
+		default:
+			decoded = raw
+		}
+		if err != nil {
+			t.Fatalf("erro ao decodificar %s: %v", encoding, err)
+		}
+
+		var filename string
+		if disposition != "" {
+			_, dispParams, err := mime.ParseMediaType(disposition)
+			if err != nil {
+				t.Fatalf("Content-Disposition inválido %q: %v", disposition, err)
+			}
+			filename = dispParams["filename"]
+		}
+
+		parts = append(parts, parsedPart{contentType: mediaType, filename: filename, body: decoded})
+	}
+
+	walk(msg.Header.Get("Content-Type"), msg.Body, "", "")
+	return msg, types, parts
+}
+
+func TestBuildMessage(t *testing.T) {
+	largeCSV := []byte(strings.Repeat("data;descrição;valor\n2025-01-01;Mesada;50,00\n", 200))
+
+	tests := []struct {
+		name        string
+		req         EmailRequest
+		types       []string
+		wantText    string
+		attachments []EmailAttachment
+	}{
+		{
+			name: "sem anexos",
+			req: EmailRequest{
+				To:      "aluno@escola.com",
+				Subject: "Seu Relatório Mensal",
+				HTML:    "<p>Olá, <b>Ana</b>!</p><p>Segue o relatório.</p>",
+			},
+			types:    []string{"multipart/alternative", "text/plain", "text/html"},
+			wantText: "Olá, Ana!\r\nSegue o relatório.", // Quebras de linha de texto viram CRLF
+		},
+		{
+			name: "texto informado",
+			req: EmailRequest{
+				To:      "aluno@escola.com",
+				Subject: "Assunto",
+				HTML:    "<p>HTML</p>",
+				Text:    "Texto próprio",
+			},
+			types:    []string{"multipart/alternative", "text/plain", "text/html"},
+			wantText: "Texto próprio",
+		},
+		{
+			name: "anexos",
+			req: EmailRequest{
+				To:      "coord@escola.com",
+				Subject: "Exportação de Dados - Lote 1/2",
+				HTML:    "<p>Em anexo</p>",
+				Attachments: []EmailAttachment{
+					{Filename: "joão_silva.csv", ContentType: csvContentType, Content: largeCSV},
+					{Filename: "dados.bin", Content: []byte{0, 1, 2, 255}},
+				},
+			},
+			types:    []string{"multipart/mixed", "multipart/alternative", "text/plain", "text/html", "text/csv", defaultAttachmentType},
+			wantText: "Em anexo",
+			attachments: []EmailAttachment{
+				{Filename: "joão_silva.csv", ContentType: "text/csv", Content: largeCSV},
+				{Filename: "dados.bin", ContentType: defaultAttachmentType, Content: []byte{0, 1, 2, 255}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messageID, raw, err := buildMessage("noreply@educasa.app.br", "Educa.SA Relatórios", tt.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			msg, types, parts := parseMessage(t, raw)
+
+			if got := msg.Header.Get("Message-ID"); got != messageID {
+				t.Errorf("Message-ID = %q, esperado %q", got, messageID)
+			}
+			if _, err := msg.Header.Date(); err != nil {
+				t.Errorf("Date inválido: %v", err)
+			}
+
+			from, err := msg.Header.AddressList("From")
+			if err != nil || len(from) != 1 || from[0].Name != "Educa.SA Relatórios" || from[0].Address != "noreply@educasa.app.br" {
+				t.Errorf("From = %v (%v)", from, err)
+			}
+			to, err := msg.Header.AddressList("To")
+			if err != nil || len(to) != 1 || to[0].Address != tt.req.To {
+				t.Errorf("To = %v (%v)", to, err)
+			}
+
+			subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+			if err != nil || subject != tt.req.Subject {
+				t.Errorf("Subject = %q (%v), esperado %q", subject, err, tt.req.Subject)
+			}
+
+			if strings.Join(types, ",") != strings.Join(tt.types, ",") {
+				t.Errorf("estrutura = %v, esperado %v", types, tt.types)
+			}
+
+			if got := string(parts[0].body); got != tt.wantText {
+				t.Errorf("text/plain = %q, esperado %q", got, tt.wantText)
+			}
+			if got := string(parts[1].body); got != tt.req.HTML {
+				t.Errorf("text/html = %q, esperado %q", got, tt.req.HTML)
+			}
+
+			gotAttachments := parts[2:]
+			if len(gotAttachments) != len(tt.attachments) {
+				t.Fatalf("%d anexos, esperado %d", len(gotAttachments), len(tt.attachments))
+			}
+			for i, want := range tt.attachments {
+				got := gotAttachments[i]
+				if got.filename != want.Filename || got.contentType != want.ContentType || !bytes.Equal(got.body, want.Content) {
+					t.Errorf("anexo %d = %s (%s, %d bytes), esperado %s (%s, %d bytes)",
+						i, got.filename, got.contentType, len(got.body), want.Filename, want.ContentType, len(want.Content))
+				}
+			}
+		})
+	}
+}
+
+func TestBuildMessageInvalidContentType(t *testing.T) {
+	_, _, err := buildMessage("noreply@educasa.app.br", "Educa.SA", EmailRequest{
+		To:          "aluno@escola.com",
+		HTML:        "<p>x</p>",
+		Attachments: []EmailAttachment{{Filename: "a.csv", ContentType: "text/csv; ;", Content: []byte("x")}},
+	})
+	if err == nil {
+		t.Fatal("esperado erro para Content-Type inválido")
+	}
+}
+
+func TestHTMLToText(t *testing.T) {
+	tests := []struct {
+		html string
+		want string
+	}{
+		{"<p>Um</p><p>Dois</p>", "Um\nDois"},
+		{"Linha<br>quebrada", "Linha\nquebrada"},
+		{"<style>p { color: red }</style><p>Visível</p>", "Visível"},
+		{"<p>R$ 10 &amp; 20 &lt;ok&gt;</p>", "R$ 10 & 20 <ok>"},
+		{"<ul><li>a</li><li>b</li></ul>", "a\nb"},
+		{"<div>\n\n\n\n<p>espaçado</p>   texto   </div>", "espaçado\ntexto"},
+	}
+
+	for _, tt := range tests {
+		if got := htmlToText(tt.html); got != tt.want {
+			t.Errorf("htmlToText(%q) = %q, esperado %q", tt.html, got, tt.want)
+		}
+	}
+}
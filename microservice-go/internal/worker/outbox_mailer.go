@@ -0,0 +1,69 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// OutboxMailer grava cada email como arquivo .eml em um diretório local (dev e CI)
+type OutboxMailer struct {
+	Dir       string
+	FromEmail string
+	FromName  string
+}
+
+// NewOutboxMailer cria o diretório de saída se necessário
+func NewOutboxMailer(dir, fromEmail, fromName string) (*OutboxMailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("erro ao criar outbox %s: %w", dir, err)
+	}
+
+	return &OutboxMailer{
+		Dir:       dir,
+		FromEmail: fromEmail,
+		FromName:  fromName,
+	}, nil
+}
+
+// SendEmail grava a mensagem MIME completa em <Dir>/<timestamp>_<destinatário>.eml
+func (o *OutboxMailer) SendEmail(ctx context.Context, req EmailRequest) (messageID string, err error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	messageID, msg, err := buildMessage(o.FromEmail, o.FromName, req)
+	if err != nil {
+		return "", fmt.Errorf("erro ao montar mensagem: %w", err)
+	}
+
+	name := fmt.Sprintf("%d_%s.eml", time.Now().UnixNano(), outboxFileName(req.To))
+	path := filepath.Join(o.Dir, name)
+
+	// Escreve em arquivo temporário e renomeia para quem lê o diretório nunca ver um .eml incompleto
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, msg, 0o644); err != nil {
+		return "", fmt.Errorf("erro ao gravar email: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return "", fmt.Errorf("erro ao gravar email: %w", err)
+	}
+
+	return messageID, nil
+}
+
+// outboxFileName mantém apenas caracteres seguros do endereço para o nome do arquivo
+func outboxFileName(address string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '@', r == '.', r == '-', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, address)
+}
@@ -0,0 +1,82 @@
+package worker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOutboxMailerSendEmail(t *testing.T) {
+	tests := []struct {
+		name     string
+		to       string
+		fileName string // Sufixo esperado do arquivo .eml
+	}{
+		{"endereço simples", "aluno@escola.com", "_aluno@escola.com.eml"},
+		{"caracteres inseguros", "a/b\\c d+x@escola.com", "_a_b_c_d_x@escola.com.eml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "outbox", "novo")
+			outbox, err := NewOutboxMailer(dir, "noreply@educasa.app.br", "Educa.SA")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			messageID, err := outbox.SendEmail(context.Background(), EmailRequest{
+				To:          tt.to,
+				Subject:     "Relatório",
+				HTML:        "<p>Olá</p>",
+				Attachments: []EmailAttachment{{Filename: "r.csv", ContentType: csvContentType, Content: []byte("a;b\n")}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 {
+				t.Fatalf("%d arquivos na outbox, esperado 1", len(entries))
+			}
+			name := entries[0].Name()
+			if !strings.HasSuffix(name, tt.fileName) {
+				t.Errorf("arquivo = %s, esperado sufixo %s", name, tt.fileName)
+			}
+
+			raw, err := os.ReadFile(filepath.Join(dir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			msg, _, parts := parseMessage(t, raw)
+			if got := msg.Header.Get("Message-ID"); got != messageID {
+				t.Errorf("Message-ID = %q, esperado %q", got, messageID)
+			}
+			if len(parts) != 3 || parts[2].filename != "r.csv" {
+				t.Errorf("partes = %+v", parts)
+			}
+		})
+	}
+}
+
+func TestOutboxMailerCancelledContext(t *testing.T) {
+	dir := t.TempDir()
+	outbox, err := NewOutboxMailer(dir, "noreply@educasa.app.br", "Educa.SA")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := outbox.SendEmail(ctx, EmailRequest{To: "aluno@escola.com", HTML: "<p>x</p>"}); err == nil {
+		t.Fatal("esperado erro com contexto cancelado")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("%d arquivos gravados com contexto cancelado", len(entries))
+	}
+}
@@ -0,0 +1,245 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"educasa/internal/database"
+)
+
+// QuotaExceededError indica que a cota diária de envios acabou.
+// O job é adiado até ResetAt em vez de falhar.
+type QuotaExceededError struct {
+	Limit   int
+	ResetAt time.Time
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("cota diária de %d emails atingida, liberada em %s", e.Limit, e.ResetAt.Format(time.RFC3339))
+}
+
+// IsQuotaExceeded informa se err é (ou embrulha) um QuotaExceededError
+func IsQuotaExceeded(err error) (*QuotaExceededError, bool) {
+	var quotaErr *QuotaExceededError
+	if errors.As(err, &quotaErr) {
+		return quotaErr, true
+	}
+	return nil, false
+}
+
+// RateLimiter limita os envios de email.
+// O limite por minuto é um token bucket em memória, por réplica (rajada de até
+// PerMinute envios, reabastecido continuamente). A cota diária é contada na
+// tabela mail_quota, compartilhada por todas as réplicas, e vira à meia-noite
+// do fuso loc. Limite 0 desativa a regra correspondente.
+type RateLimiter struct {
+	db        *sql.DB
+	perMinute int
+	perDay    int
+	loc       *time.Location
+
+	mu         sync.Mutex
+	tokens     float64
+	lastRefill time.Time
+	throttled  int64 // Envios que esperaram por token
+	deferred   int64 // Vezes em que a cota diária adiou um job
+}
+
+// RateLimitStats é o uso da cota exposto em /health e /metrics
+type RateLimitStats struct {
+	PerMinuteLimit  int       `json:"per_minute_limit"`
+	PerDayLimit     int       `json:"per_day_limit"`
+	AvailableTokens int       `json:"available_tokens"`
+	SentToday       int       `json:"sent_today"`      // Reservados no dia por todas as réplicas
+	RemainingToday  int       `json:"remaining_today"` // -1 sem limite diário
+	DayResetsAt     time.Time `json:"day_resets_at"`
+	ThrottledTotal  int64     `json:"throttled_total"`
+	DeferredTotal   int64     `json:"deferred_total"`
+}
+
+// NewRateLimiter cria um limitador com o bucket cheio
+func NewRateLimiter(db *sql.DB, perMinute, perDay int, loc *time.Location) *RateLimiter {
+	return &RateLimiter{
+		db:         db,
+		perMinute:  perMinute,
+		perDay:     perDay,
+		loc:        loc,
+		tokens:     float64(perMinute),
+		lastRefill: time.Now(),
+	}
+}
+
+// Wait bloqueia até haver token no limite por minuto
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if l.perMinute <= 0 {
+		return nil
+	}
+
+	counted := false
+
+	for {
+		l.mu.Lock()
+		l.refill(time.Now())
+
+		if l.tokens >= 1 {
+			l.tokens--
+			l.mu.Unlock()
+			return nil
+		}
+
+		// Tempo até o próximo token
+		wait := time.Duration((1 - l.tokens) / float64(l.perMinute) * float64(time.Minute))
+		if !counted {
+			l.throttled++
+			counted = true
+		}
+		l.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Reserve reserva na cota diária até n envios antes de um batch, limitado ao
+// que resta no dia, e retorna *QuotaExceededError só se a cota já acabou. Uma
+// reserva parcial deixa o batch avançar; take reserva o restante envio a envio
+// até a cota acabar.
+func (l *RateLimiter) Reserve(ctx context.Context, n int) (*QuotaReservation, error) {
+	reservation := &QuotaReservation{limiter: l}
+	if l.perDay <= 0 || n <= 0 {
+		return reservation, nil
+	}
+
+	day, resetAt := l.quotaDay(time.Now())
+
+	reserved, err := database.ReserveMailQuota(ctx, l.db, day, n, l.perDay)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao reservar cota diária: %w", err)
+	}
+	if reserved == 0 {
+		l.mu.Lock()
+		l.deferred++
+		l.mu.Unlock()
+		return nil, &QuotaExceededError{Limit: l.perDay, ResetAt: resetAt}
+	}
+
+	reservation.day = day
+	reservation.remaining = reserved
+	return reservation, nil
+}
+
+// Stats retorna o uso atual dos limites
+func (l *RateLimiter) Stats(ctx context.Context) RateLimitStats {
+	l.mu.Lock()
+	l.refill(time.Now())
+	stats := RateLimitStats{
+		PerMinuteLimit:  l.perMinute,
+		PerDayLimit:     l.perDay,
+		AvailableTokens: int(l.tokens),
+		RemainingToday:  -1,
+		ThrottledTotal:  l.throttled,
+		DeferredTotal:   l.deferred,
+	}
+	l.mu.Unlock()
+
+	day, resetAt := l.quotaDay(time.Now())
+	stats.DayResetsAt = resetAt
+
+	sent, err := database.GetMailQuotaUsage(ctx, l.db, day)
+	if err != nil {
+		log.Printf("Error reading mail quota usage: %v", err)
+	}
+	stats.SentToday = sent
+
+	if l.perDay > 0 {
+		stats.RemainingToday = max(l.perDay-sent, 0)
+	}
+
+	return stats
+}
+
+// refill repõe tokens proporcionalmente ao tempo decorrido.
+// Deve ser chamado com mu travado.
+func (l *RateLimiter) refill(now time.Time) {
+	if l.perMinute > 0 {
+		elapsed := now.Sub(l.lastRefill)
+		l.tokens = min(l.tokens+elapsed.Minutes()*float64(l.perMinute), float64(l.perMinute))
+	}
+	l.lastRefill = now
+}
+
+// quotaDay retorna o dia da cota de t (AAAA-MM-DD no fuso loc) e quando ele termina
+func (l *RateLimiter) quotaDay(t time.Time) (day string, resetAt time.Time) {
+	year, month, d := t.In(l.loc).Date()
+	start := time.Date(year, month, d, 0, 0, 0, 0, l.loc)
+	return start.Format("2006-01-02"), start.AddDate(0, 0, 1)
+}
+
+// QuotaReservation são envios da cota diária reservados para um batch
+type QuotaReservation struct {
+	limiter   *RateLimiter
+	day       string
+	remaining int
+}
+
+// take consome um envio da reserva. Esgotada a reserva, reserva mais um na cota do dia.
+func (r *QuotaReservation) take(ctx context.Context) error {
+	if r == nil || r.limiter.perDay <= 0 {
+		return nil
+	}
+	if r.remaining > 0 {
+		r.remaining--
+		return nil
+	}
+
+	extra, err := r.limiter.Reserve(ctx, 1)
+	if err != nil {
+		return err
+	}
+	r.day = extra.day
+	return nil
+}
+
+// Release devolve à cota os envios reservados e não usados
+func (r *QuotaReservation) Release(ctx context.Context) {
+	if r == nil || r.remaining == 0 {
+		return
+	}
+
+	// Devolver mesmo que o contexto do job tenha expirado
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+
+	if err := database.ReleaseMailQuota(ctx, r.limiter.db, r.day, r.remaining); err != nil {
+		log.Printf("Error releasing %d reserved emails: %v", r.remaining, err)
+		return
+	}
+	r.remaining = 0
+}
+
+// limitedSession aplica os limites de envio antes de cada envio da sessão
+type limitedSession struct {
+	MailSession
+	limiter     *RateLimiter
+	reservation *QuotaReservation
+}
+
+func (s limitedSession) SendEmail(ctx context.Context, req EmailRequest) (string, error) {
+	if err := s.limiter.Wait(ctx); err != nil {
+		return "", err
+	}
+	if err := s.reservation.take(ctx); err != nil {
+		return "", err
+	}
+	return s.MailSession.SendEmail(ctx, req)
+}
@@ -0,0 +1,219 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"educasa/internal/database"
+)
+
+// openQuotaDB abre um banco local vazio com o schema do worker
+func openQuotaDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("libsql", "file:"+filepath.Join(t.TempDir(), "quota.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := database.InitSchema(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestRateLimiterReserve(t *testing.T) {
+	tests := []struct {
+		name         string
+		perDay       int
+		used         int // Já reservados no dia
+		n            int
+		wantErr      bool
+		wantReserved int
+		wantUsed     int // Uso do dia após a reserva
+	}{
+		{"dentro da cota", 10, 0, 4, false, 4, 4},
+		{"exatamente a cota restante", 10, 6, 4, false, 4, 10},
+		{"acima da cota restante reserva o que resta", 10, 8, 4, false, 2, 10},
+		{"maior que a cota com o dia livre", 10, 0, 25, false, 10, 10},
+		{"maior que a cota com o dia em uso", 10, 1, 25, false, 9, 10},
+		{"cota esgotada", 10, 10, 1, true, 0, 10},
+		{"sem limite diário", 0, 0, 1000, false, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			limiter := NewRateLimiter(openQuotaDB(t), 0, tt.perDay, time.UTC)
+
+			if tt.used > 0 {
+				if _, err := limiter.Reserve(ctx, tt.used); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			reservation, err := limiter.Reserve(ctx, tt.n)
+			if tt.wantErr {
+				quotaErr, ok := IsQuotaExceeded(err)
+				if !ok {
+					t.Fatalf("erro = %v, esperado QuotaExceededError", err)
+				}
+				if quotaErr.Limit != tt.perDay {
+					t.Errorf("Limit = %d, esperado %d", quotaErr.Limit, tt.perDay)
+				}
+				if stats := limiter.Stats(ctx); stats.DeferredTotal != 1 {
+					t.Errorf("DeferredTotal = %d, esperado 1", stats.DeferredTotal)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else if reservation.remaining != tt.wantReserved {
+				t.Errorf("reservados = %d, esperado %d", reservation.remaining, tt.wantReserved)
+			}
+
+			if stats := limiter.Stats(ctx); stats.SentToday != tt.wantUsed {
+				t.Errorf("SentToday = %d, esperado %d", stats.SentToday, tt.wantUsed)
+			}
+		})
+	}
+}
+
+func TestQuotaReservationTakeAndRelease(t *testing.T) {
+	ctx := context.Background()
+	limiter := NewRateLimiter(openQuotaDB(t), 0, 5, time.UTC)
+
+	reservation, err := limiter.Reserve(ctx, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Um envio da reserva e a sobra devolvida
+	if err := reservation.take(ctx); err != nil {
+		t.Fatal(err)
+	}
+	reservation.Release(ctx)
+	if stats := limiter.Stats(ctx); stats.SentToday != 1 || stats.RemainingToday != 4 {
+		t.Fatalf("após Release: enviados %d, restantes %d; esperado 1 e 4", stats.SentToday, stats.RemainingToday)
+	}
+
+	// Reserva esgotada: cada envio extra reserva mais um até a cota acabar
+	reservation, err = limiter.Reserve(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		if err := reservation.take(ctx); err != nil {
+			t.Fatalf("envio %d: %v", i+1, err)
+		}
+	}
+	if _, ok := IsQuotaExceeded(reservation.take(ctx)); !ok {
+		t.Fatal("esperado QuotaExceededError após esgotar a cota")
+	}
+	if stats := limiter.Stats(ctx); stats.SentToday != 5 {
+		t.Errorf("SentToday = %d, esperado 5", stats.SentToday)
+	}
+}
+
+func TestRateLimiterSharedAcrossReplicas(t *testing.T) {
+	ctx := context.Background()
+	db := openQuotaDB(t)
+	// Arquivo local não aceita escritas concorrentes; no Turso o primário as serializa
+	db.SetMaxOpenConns(1)
+
+	const perDay = 20
+	replicas := []*RateLimiter{
+		NewRateLimiter(db, 0, perDay, time.UTC),
+		NewRateLimiter(db, 0, perDay, time.UTC),
+	}
+
+	var mu sync.Mutex
+	reserved := 0
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		limiter := replicas[i%len(replicas)]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reservation, err := limiter.Reserve(ctx, 3)
+			if err == nil {
+				mu.Lock()
+				reserved += reservation.remaining
+				mu.Unlock()
+				return
+			}
+			if _, ok := IsQuotaExceeded(err); !ok {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if reserved != perDay {
+		t.Errorf("reservados = %d, esperado %d", reserved, perDay)
+	}
+	for i, limiter := range replicas {
+		if stats := limiter.Stats(ctx); stats.SentToday != reserved {
+			t.Errorf("réplica %d: SentToday = %d, esperado %d", i, stats.SentToday, reserved)
+		}
+	}
+}
+
+func TestRateLimiterQuotaDay(t *testing.T) {
+	saoPaulo, err := time.LoadLocation("America/Sao_Paulo")
+	if err != nil {
+		t.Skipf("fuso indisponível: %v", err)
+	}
+
+	// 01:30 UTC de 2 de março ainda é 1º de março em São Paulo (UTC-3)
+	now := time.Date(2025, 3, 2, 1, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		loc       *time.Location
+		wantDay   string
+		wantReset time.Time
+	}{
+		{time.UTC, "2025-03-02", time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC)},
+		{saoPaulo, "2025-03-01", time.Date(2025, 3, 2, 3, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.loc.String(), func(t *testing.T) {
+			limiter := NewRateLimiter(nil, 0, 10, tt.loc)
+			day, resetAt := limiter.quotaDay(now)
+			if day != tt.wantDay || !resetAt.Equal(tt.wantReset) {
+				t.Errorf("quotaDay = %s, %v; esperado %s, %v", day, resetAt, tt.wantDay, tt.wantReset)
+			}
+		})
+	}
+}
+
+func TestRateLimiterWait(t *testing.T) {
+	limiter := NewRateLimiter(nil, 3, 0, time.UTC)
+
+	// Rajada de até perMinute envios sem espera
+	for i := 0; i < 3; i++ {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Bucket vazio: o próximo token demora ~20s, então o contexto expira antes
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := limiter.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("erro = %v, esperado DeadlineExceeded", err)
+	}
+
+	limiter.mu.Lock()
+	throttled := limiter.throttled
+	limiter.mu.Unlock()
+	if throttled != 1 {
+		t.Errorf("throttled = %d, esperado 1", throttled)
+	}
+}
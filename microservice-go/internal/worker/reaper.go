@@ -0,0 +1,89 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"educasa/internal/database"
+	"educasa/internal/models"
+)
+
+// reapStuckJobs recupera jobs presos em PROCESSING após queda de um worker.
+// Um job é considerado preso quando o lease expirou ou quando está em
+// processamento há mais que JobTimeout.
+func (jp *JobProcessor) reapStuckJobs(ctx context.Context) {
+	jobs, err := database.GetProcessingJobs(ctx, jp.db)
+	if err != nil {
+		log.Printf("Reaper: error fetching processing jobs: %v", err)
+		return
+	}
+
+	now := time.Now()
+	for _, job := range jobs {
+		reason := stuckReason(job, now, jp.cfg.JobTimeout)
+		if reason == "" {
+			continue
+		}
+
+		retryCount := job.RetryCount + 1
+		status := "PENDING"
+		if job.CancelRequestedAt != nil {
+			// O cancelamento foi pedido antes da queda: não tentar de novo
+			status = "CANCELLED"
+		} else if retryCount >= job.MaxRetries {
+			status = "FAILED"
+		}
+
+		nextAttemptAt := now.Add(jp.retryPolicy(job.Type).NextDelay(retryCount))
+		errorMessage := fmt.Sprintf("job recuperado pelo reaper: %s", reason)
+		recovered, err := database.RecoverJob(ctx, jp.db, job, status, retryCount, nextAttemptAt, errorMessage)
+		if err != nil {
+			log.Printf("Reaper: error recovering job %s: %v", job.ID, err)
+			continue
+		}
+		if !recovered {
+			// O dono renovou o lease ou outra réplica já recuperou o job
+			continue
+		}
+
+		log.Printf("Reaper: recovered job %s (owner=%s, %s) -> %s (retry %d/%d)",
+			job.ID, leaseOwnerLabel(job), reason, status, retryCount, job.MaxRetries)
+
+		exportStatus := database.EmailExportRetrying
+		if status != "PENDING" {
+			exportStatus = database.EmailExportFailed
+		}
+		jp.syncEmailExports(ctx, job, database.EmailExportUpdate{
+			Status:       exportStatus,
+			RetryCount:   &retryCount,
+			ErrorMessage: errorMessage,
+		})
+	}
+}
+
+// stuckReason retorna o motivo pelo qual o job está preso, ou "" se não estiver
+func stuckReason(job models.Job, now time.Time, timeout time.Duration) string {
+	if job.LeaseExpiresAt != nil && now.After(*job.LeaseExpiresAt) {
+		return fmt.Sprintf("lease expirado em %s", job.LeaseExpiresAt.Format(time.RFC3339))
+	}
+
+	startedAt := job.StartedAt
+	if startedAt == nil {
+		startedAt = &job.CreatedAt
+	}
+	if now.Sub(*startedAt) > timeout {
+		return fmt.Sprintf("em processamento há mais de %v", timeout)
+	}
+
+	return ""
+}
+
+// leaseOwnerLabel retorna o dono do lease para logs
+func leaseOwnerLabel(job models.Job) string {
+	if job.LeaseOwner == nil {
+		return "none"
+	}
+	return *job.LeaseOwner
+}
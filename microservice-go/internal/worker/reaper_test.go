@@ -0,0 +1,116 @@
+package worker
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"educasa/internal/config"
+	"educasa/internal/database"
+	"educasa/internal/models"
+)
+
+func TestReapStuckJobs(t *testing.T) {
+	now := time.Now()
+	expired := database.FormatTime(now.Add(-time.Minute))
+	live := database.FormatTime(now.Add(time.Minute))
+	recent := database.FormatTime(now.Add(-time.Minute))
+	old := database.FormatTime(now.Add(-time.Hour))
+
+	tests := []struct {
+		name           string
+		leaseExpiresAt string
+		startedAt      string
+		retryCount     int
+		cancelled      bool
+		wantStatus     string
+		wantRetryCount int
+	}{
+		{"lease expirado volta à fila", expired, recent, 0, false, "PENDING", 1},
+		{"lease válido não é tocado", live, recent, 0, false, "PROCESSING", 0},
+		{"lease válido além do JobTimeout", live, old, 0, false, "PENDING", 1},
+		{"lease expirado sem tentativas restantes", expired, recent, 2, false, "FAILED", 3},
+		{"lease expirado com cancelamento pedido", expired, recent, 0, true, "CANCELLED", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			db := openQuotaDB(t)
+
+			var cancelRequestedAt interface{}
+			if tt.cancelled {
+				cancelRequestedAt = recent
+			}
+			_, err := db.Exec(`
+				INSERT INTO export_jobs (id, type, status, payload, started_at, retry_count, max_retries,
+				                         lease_owner, lease_expires_at, cancel_requested_at)
+				VALUES ('job_1', 'MANUAL', 'PROCESSING', '{}', ?, ?, 3, 'worker-morto', ?, ?)
+			`, tt.startedAt, tt.retryCount, tt.leaseExpiresAt, cancelRequestedAt)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			jp := NewJobProcessor(db, nil, &config.Config{
+				WorkerID:       "worker-vivo",
+				JobTimeout:     10 * time.Minute,
+				RetryBaseDelay: time.Second,
+				RetryMaxDelay:  time.Minute,
+			})
+			jp.reapStuckJobs(ctx)
+
+			job, err := database.GetJob(ctx, db, "job_1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if job.Status != tt.wantStatus || job.RetryCount != tt.wantRetryCount {
+				t.Fatalf("status = %s, retry_count = %d; esperado %s, %d", job.Status, job.RetryCount, tt.wantStatus, tt.wantRetryCount)
+			}
+			if tt.wantStatus == "PROCESSING" {
+				return
+			}
+
+			if job.LeaseOwner != nil || job.LeaseExpiresAt != nil {
+				t.Errorf("lease não liberado: %v, %v", job.LeaseOwner, job.LeaseExpiresAt)
+			}
+			if job.ErrorMessage == nil || !strings.HasPrefix(*job.ErrorMessage, "job recuperado pelo reaper") {
+				t.Errorf("error_message = %v", job.ErrorMessage)
+			}
+			if (job.CompletedAt == nil) != (tt.wantStatus == "PENDING") {
+				t.Errorf("completed_at = %v com status %s", job.CompletedAt, tt.wantStatus)
+			}
+			if tt.wantStatus == "PENDING" && (job.NextAttemptAt == nil || !job.NextAttemptAt.After(now.Add(-time.Second))) {
+				t.Errorf("next_attempt_at = %v, esperado após o reap", job.NextAttemptAt)
+			}
+		})
+	}
+}
+
+func TestStuckReason(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+
+	tests := []struct {
+		name       string
+		job        models.Job
+		wantPrefix string // Vazio: job não está preso
+	}{
+		{"lease expirado", models.Job{LeaseExpiresAt: at(-time.Second), StartedAt: at(-time.Minute)}, "lease expirado"},
+		{"lease válido", models.Job{LeaseExpiresAt: at(time.Second), StartedAt: at(-time.Minute)}, ""},
+		{"além do timeout", models.Job{LeaseExpiresAt: at(time.Second), StartedAt: at(-time.Hour)}, "em processamento há mais de"},
+		{"sem lease nem started_at usa created_at", models.Job{CreatedAt: now.Add(-time.Hour)}, "em processamento há mais de"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason := stuckReason(tt.job, now, 10*time.Minute)
+			if tt.wantPrefix == "" && reason != "" || !strings.HasPrefix(reason, tt.wantPrefix) {
+				t.Errorf("stuckReason = %q, esperado prefixo %q", reason, tt.wantPrefix)
+			}
+		})
+	}
+}
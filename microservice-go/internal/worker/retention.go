@@ -0,0 +1,31 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"educasa/internal/database"
+)
+
+// PurgeOldJobs aplica a política de retenção: remove jobs finalizados
+// há mais de JobRetentionDays e seus batches
+func (s *Scheduler) PurgeOldJobs() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	cutoff := RetentionCutoff(s.cfg.JobRetentionDays, time.Now())
+	report, err := database.PurgeJobs(ctx, s.db, cutoff)
+	if err != nil {
+		log.Printf("Retention: error purging jobs: %v", err)
+		return
+	}
+
+	log.Printf("Retention: purged %d jobs and %d batches finished before %s %v",
+		report.Jobs, report.Batches, cutoff.Format(time.RFC3339), report.ByStatus)
+}
+
+// RetentionCutoff retorna o horário antes do qual jobs finalizados são removidos
+func RetentionCutoff(retentionDays int, now time.Time) time.Time {
+	return now.AddDate(0, 0, -retentionDays)
+}
@@ -0,0 +1,62 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"educasa/internal/config"
+	"educasa/internal/database"
+)
+
+func TestRetentionCutoff(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		days int
+		want time.Time
+	}{
+		{1, time.Date(2025, 2, 28, 12, 0, 0, 0, time.UTC)},
+		{30, time.Date(2025, 1, 30, 12, 0, 0, 0, time.UTC)},
+		{365, time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		if got := RetentionCutoff(tt.days, now); !got.Equal(tt.want) {
+			t.Errorf("RetentionCutoff(%d) = %v, esperado %v", tt.days, got, tt.want)
+		}
+	}
+}
+
+func TestPurgeOldJobs(t *testing.T) {
+	ctx := context.Background()
+	db := openQuotaDB(t)
+
+	seed := []struct {
+		id          string
+		completedAt time.Time
+		wantKept    bool
+	}{
+		{"job_antigo", time.Now().AddDate(0, 0, -31), false},
+		{"job_recente", time.Now().AddDate(0, 0, -29), true},
+	}
+	for _, s := range seed {
+		_, err := db.Exec(
+			`INSERT INTO export_jobs (id, type, status, payload, completed_at) VALUES (?, 'MANUAL', 'COMPLETED', '{}', ?)`,
+			s.id, database.FormatTime(s.completedAt),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := NewScheduler(&config.Config{JobRetentionDays: 30}, db)
+	s.PurgeOldJobs()
+
+	for _, j := range seed {
+		_, err := database.GetJob(ctx, db, j.id)
+		if kept := err == nil; kept != j.wantKept {
+			t.Errorf("%s: mantido = %v, esperado %v", j.id, kept, j.wantKept)
+		}
+	}
+}
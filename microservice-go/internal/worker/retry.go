@@ -0,0 +1,54 @@
+package worker
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy define o backoff exponencial entre tentativas de um job
+type RetryPolicy struct {
+	BaseDelay  time.Duration // Atraso antes da primeira nova tentativa
+	MaxDelay   time.Duration // Limite do atraso
+	Multiplier float64       // Fator de crescimento a cada tentativa
+	Jitter     float64       // Fração aleatória (0-1) somada ao atraso
+}
+
+// NextDelay calcula o atraso antes da tentativa de número retryCount (1, 2, ...)
+func (p RetryPolicy) NextDelay(retryCount int) time.Duration {
+	if retryCount < 1 {
+		retryCount = 1
+	}
+
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	delay := float64(p.BaseDelay) * math.Pow(multiplier, float64(retryCount-1))
+
+	// Jitter evita que jobs que falharam juntos voltem todos ao mesmo tempo
+	if p.Jitter > 0 {
+		delay += delay * p.Jitter * rand.Float64()
+	}
+
+	// Limite aplicado por último: o jitter nunca passa de MaxDelay
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+
+	return time.Duration(delay)
+}
+
+// SetRetryPolicy define a política de retry para um tipo de job
+func (jp *JobProcessor) SetRetryPolicy(jobType string, policy RetryPolicy) {
+	jp.retryPolicies[jobType] = policy
+}
+
+// retryPolicy retorna a política do tipo de job ou a política padrão
+func (jp *JobProcessor) retryPolicy(jobType string) RetryPolicy {
+	if policy, ok := jp.retryPolicies[jobType]; ok {
+		return policy
+	}
+	return jp.defaultRetryPolicy
+}
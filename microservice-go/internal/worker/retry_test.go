@@ -0,0 +1,51 @@
+package worker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyNextDelay(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: time.Minute, MaxDelay: 10 * time.Minute, Multiplier: 2}
+
+	tests := []struct {
+		retryCount int
+		want       time.Duration
+	}{
+		{0, time.Minute}, // Tratado como primeira tentativa
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{4, 8 * time.Minute},
+		{5, 10 * time.Minute},
+		{30, 10 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := policy.NextDelay(tt.retryCount); got != tt.want {
+			t.Errorf("NextDelay(%d) = %v, esperado %v", tt.retryCount, got, tt.want)
+		}
+	}
+}
+
+func TestRetryPolicyJitterRespectsMaxDelay(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: time.Minute, MaxDelay: 10 * time.Minute, Multiplier: 2, Jitter: 0.5}
+
+	tests := []struct {
+		retryCount int
+		min, max   time.Duration
+	}{
+		{1, time.Minute, 90 * time.Second},
+		{3, 4 * time.Minute, 6 * time.Minute},
+		{4, 8 * time.Minute, 10 * time.Minute}, // 8m + jitter passaria de 10m
+		{10, 10 * time.Minute, 10 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 200; i++ {
+			got := policy.NextDelay(tt.retryCount)
+			if got < tt.min || got > tt.max {
+				t.Fatalf("NextDelay(%d) = %v, fora de [%v, %v]", tt.retryCount, got, tt.min, tt.max)
+			}
+		}
+	}
+}
@@ -2,32 +2,62 @@ package worker
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"log"
+	"sync"
 	"time"
 
-	"github.com/robfig/cron/v3"
 	"educasa/internal/config"
+	"educasa/internal/database"
+	"educasa/internal/models"
+
+	"github.com/robfig/cron/v3"
 )
 
-// Scheduler gerencia jobs agendados (cron)
+// Scheduler gerencia jobs agendados (cron): o mensal da configuração
+// e os agendamentos da tabela export_schedules
 type Scheduler struct {
 	cfg            *config.Config
-	db             interface{} // *sql.DB - usar interface para evitar import circular
+	db             *sql.DB
 	cron           *cron.Cron
-	enqueueJobFunc func(context.Context, map[string]interface{}) (string, error)
+	enqueueJobFunc func(context.Context, models.EnqueueRequest) (string, error)
+
+	// Agendamentos carregados, por ID
+	mu      sync.Mutex
+	entries map[string]scheduleEntry
+
+	stopReload chan struct{}
+	reloadDone chan struct{}
+}
+
+// scheduleEntry liga um agendamento à sua entrada no cron
+type scheduleEntry struct {
+	entryID cron.EntryID
+	version int
 }
 
 // NewScheduler cria um novo scheduler
-func NewScheduler(cfg *config.Config, db interface{}) *Scheduler {
+func NewScheduler(cfg *config.Config, db *sql.DB) *Scheduler {
 	return &Scheduler{
 		cfg:  cfg,
 		db:   db,
 		cron: cron.New(),
+
+		// Agendamentos carregados, por ID
+		entries: make(map[string]scheduleEntry),
 	}
 }
 
+// ParseCron valida uma expressão cron no formato aceito pelo scheduler (5 campos)
+func ParseCron(spec string) error {
+	_, err := cron.ParseStandard(spec)
+	return err
+}
+
 // SetEnqueueJobFunc define a função para enfileirar jobs
-func (s *Scheduler) SetEnqueueJobFunc(fn func(context.Context, map[string]interface{}) (string, error)) {
+func (s *Scheduler) SetEnqueueJobFunc(fn func(context.Context, models.EnqueueRequest) (string, error)) {
 	s.enqueueJobFunc = fn
 }
 
@@ -47,19 +77,172 @@ func (s *Scheduler) Start() error {
 		return err
 	}
 
+	// Limpeza de jobs antigos
+	if s.cfg.JobRetentionDays > 0 {
+		if _, err := s.cron.AddFunc(s.cfg.RetentionCron, s.PurgeOldJobs); err != nil {
+			return fmt.Errorf("invalid RETENTION_CRON: %w", err)
+		}
+		log.Printf("Retention enabled: jobs finished more than %d days ago are purged (cron: %s)", s.cfg.JobRetentionDays, s.cfg.RetentionCron)
+	}
+
+	// Agendamentos do banco
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := s.ReloadSchedules(ctx); err != nil {
+		return fmt.Errorf("failed to load export schedules: %w", err)
+	}
+
 	s.cron.Start()
-	log.Printf("Scheduler started with cron: %s", s.cfg.MonthlyCron)
+
+	// Outras réplicas podem alterar os agendamentos: recarregar periodicamente
+	s.stopReload = make(chan struct{})
+	s.reloadDone = make(chan struct{})
+	go s.pollSchedules()
+
+	log.Printf("Scheduler started with cron: %s (%d export schedules)", s.cfg.MonthlyCron, s.loadedSchedules())
 	return nil
 }
 
 // Stop para o scheduler
 func (s *Scheduler) Stop() {
 	log.Println("Stopping scheduler")
+	if s.stopReload != nil {
+		close(s.stopReload)
+		<-s.reloadDone
+	}
 	ctx := s.cron.Stop()
 	<-ctx.Done()
 }
 
-// EnqueueMonthlyJob enfileira o job de exportação mensal
+// pollSchedules recarrega os agendamentos a cada ScheduleReloadInterval
+func (s *Scheduler) pollSchedules() {
+	defer close(s.reloadDone)
+
+	ticker := time.NewTicker(s.cfg.ScheduleReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopReload:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			if err := s.ReloadSchedules(ctx); err != nil {
+				log.Printf("Error reloading export schedules: %v", err)
+			}
+			cancel()
+		}
+	}
+}
+
+// ReloadSchedules sincroniza as entradas do cron com a tabela export_schedules.
+// Só agendamentos novos, alterados (versão diferente) ou removidos são tocados.
+func (s *Scheduler) ReloadSchedules(ctx context.Context) error {
+	if !s.cfg.EnableScheduler {
+		return nil
+	}
+
+	schedules, err := database.ListSchedules(ctx, s.db)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	active := make(map[string]bool, len(schedules))
+	for _, sched := range schedules {
+		if !sched.Enabled {
+			continue
+		}
+		active[sched.ID] = true
+
+		if entry, ok := s.entries[sched.ID]; ok {
+			if entry.version == sched.Version {
+				continue
+			}
+			s.cron.Remove(entry.entryID)
+			delete(s.entries, sched.ID)
+		}
+
+		sched := sched
+		entryID, err := s.cron.AddFunc(sched.Cron, func() {
+			s.runSchedule(sched)
+		})
+		if err != nil {
+			log.Printf("Skipping export schedule %s (%s): invalid cron %q: %v", sched.ID, sched.Name, sched.Cron, err)
+			continue
+		}
+
+		s.entries[sched.ID] = scheduleEntry{entryID: entryID, version: sched.Version}
+		log.Printf("Export schedule %s (%s) loaded: %s", sched.ID, sched.Name, sched.Cron)
+	}
+
+	// Remover agendamentos apagados ou desativados
+	for id, entry := range s.entries {
+		if !active[id] {
+			s.cron.Remove(entry.entryID)
+			delete(s.entries, id)
+			log.Printf("Export schedule %s unloaded", id)
+		}
+	}
+
+	return nil
+}
+
+// loadedSchedules retorna quantos agendamentos estão no cron
+func (s *Scheduler) loadedSchedules() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+// runSchedule enfileira o job de um agendamento.
+// A chave de idempotência usa o minuto do disparo, então réplicas que
+// disparam o mesmo agendamento criam um único job.
+func (s *Scheduler) runSchedule(sched models.ExportSchedule) {
+	firedAt := time.Now().Truncate(time.Minute)
+	log.Printf("Running export schedule %s (%s)", sched.ID, sched.Name)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	start, end, err := models.PeriodRange(sched.Period, firedAt)
+	if err != nil {
+		log.Printf("Error running export schedule %s: %v", sched.ID, err)
+		return
+	}
+
+	if s.enqueueJobFunc == nil {
+		log.Println("Warning: enqueueJobFunc not set, scheduled job not created")
+		return
+	}
+
+	jobID, err := s.enqueueJobFunc(ctx, models.EnqueueRequest{
+		Type:           models.JobTypeManual,
+		MaxRetries:     models.DefaultMaxRetries,
+		Payload:        sched.Payload(start, end),
+		IdempotencyKey: fmt.Sprintf("schedule:%s:%s", sched.ID, firedAt.UTC().Format(time.RFC3339)),
+	})
+	if errors.Is(err, models.ErrDuplicateIdempotencyKey) {
+		log.Printf("Export schedule %s already enqueued for %s by another replica", sched.ID, firedAt.Format(time.RFC3339))
+		return
+	}
+	if err != nil {
+		log.Printf("Error enqueuing scheduled job %s: %v", sched.ID, err)
+		return
+	}
+
+	if err := database.MarkScheduleRun(ctx, s.db, sched.ID, firedAt, jobID); err != nil {
+		log.Printf("Error recording run of export schedule %s: %v", sched.ID, err)
+	}
+
+	log.Printf("Scheduled export job enqueued: %s (schedule %s)", jobID, sched.ID)
+}
+
+// EnqueueMonthlyJob enfileira o job de exportação mensal.
+// A chave de idempotência usa o mês exportado, então réplicas (ou um
+// disparo repetido) criam um único job por mês.
 func (s *Scheduler) EnqueueMonthlyJob() {
 	log.Println("Running monthly export job")
 
@@ -67,22 +250,36 @@ func (s *Scheduler) EnqueueMonthlyJob() {
 	defer cancel()
 
 	// Calcular período do mês anterior
-	now := time.Now()
-	lastMonth := time.Date(now.Year(), now.Month()-1, 1, 0, 0, 0, 0, time.Local)
-	endOfLastMonth := time.Date(now.Year(), now.Month(), 0, 23, 59, 59, 0, time.Local)
+	lastMonth, endOfLastMonth, _ := models.PeriodRange(models.PeriodLastMonth, time.Now())
+
+	// Destino das exportações
+	toEmail := s.cfg.ExportToEmail
+	if toEmail == "" {
+		log.Println("Warning: EXPORT_TO_EMAIL not set, using SMTP_FROM_EMAIL")
+		toEmail = s.cfg.SMTPFromEmail
+	}
 
-	// TODO: Buscar alunos com consentimento do banco
-	// Por enquanto, cria job stub
+	// Os alunos com consentimento são resolvidos na execução do job
 	payload := map[string]interface{}{
-		"start_date": lastMonth.Format(time.RFC3339),
-		"end_date":   endOfLastMonth.Format(time.RFC3339),
-		"to_email":   s.cfg.SMTPFromEmail,
-		"type":       "MONTHLY_AUTO",
+		"all_consenting": true,
+		"delivery_mode":  s.cfg.MonthlyDeliveryMode,
+		"start_date":     lastMonth.Format(time.RFC3339),
+		"end_date":       endOfLastMonth.Format(time.RFC3339),
+		"to_email":       toEmail,
 	}
 
 	if s.enqueueJobFunc != nil {
-		jobID, err := s.enqueueJobFunc(ctx, payload)
-		if err != nil {
+		month := lastMonth.Format("2006-01")
+		jobID, err := s.enqueueJobFunc(ctx, models.EnqueueRequest{
+			Type:           models.JobTypeMonthlyAuto,
+			Priority:       1,
+			MaxRetries:     models.DefaultMaxRetries,
+			Payload:        payload,
+			IdempotencyKey: "monthly:" + month,
+		})
+		if errors.Is(err, models.ErrDuplicateIdempotencyKey) {
+			log.Printf("Monthly export job for %s already enqueued", month)
+		} else if err != nil {
 			log.Printf("Error enqueuing monthly job: %v", err)
 		} else {
 			log.Printf("Monthly export job enqueued: %s", jobID)
@@ -0,0 +1,177 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"educasa/internal/config"
+	"educasa/internal/database"
+	"educasa/internal/models"
+)
+
+func TestSchedulerReloadSchedules(t *testing.T) {
+	ctx := context.Background()
+	db := openQuotaDB(t)
+	s := NewScheduler(&config.Config{EnableScheduler: true}, db)
+
+	weekly := &models.ExportSchedule{
+		Name:         "Semanal",
+		Cron:         "0 8 * * 1",
+		TargetType:   models.ScheduleTargetConsenting,
+		Period:       models.PeriodLastWeek,
+		DeliveryMode: models.DeliveryModeRecipient,
+		Enabled:      true,
+	}
+	if err := database.CreateSchedule(ctx, db, weekly); err != nil {
+		t.Fatal(err)
+	}
+	disabled := &models.ExportSchedule{
+		Name:         "Desativado",
+		Cron:         "0 8 1 * *",
+		TargetType:   models.ScheduleTargetConsenting,
+		Period:       models.PeriodLastMonth,
+		DeliveryMode: models.DeliveryModeRecipient,
+	}
+	if err := database.CreateSchedule(ctx, db, disabled); err != nil {
+		t.Fatal(err)
+	}
+
+	entryOf := func(id string) (scheduleEntry, bool) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		entry, ok := s.entries[id]
+		return entry, ok
+	}
+
+	tests := []struct {
+		name        string
+		change      func() error
+		wantLoaded  []string
+		wantVersion int  // Versão carregada de weekly
+		wantNewID   bool // weekly ganhou nova entrada no cron
+	}{
+		{
+			name:        "carga inicial ignora desativados",
+			change:      func() error { return nil },
+			wantLoaded:  []string{weekly.ID},
+			wantVersion: 1,
+			wantNewID:   true,
+		},
+		{
+			name:        "sem alteração mantém a entrada",
+			change:      func() error { return nil },
+			wantLoaded:  []string{weekly.ID},
+			wantVersion: 1,
+		},
+		{
+			name: "alteração troca a entrada",
+			change: func() error {
+				weekly.Cron = "30 7 * * 1"
+				_, err := database.UpdateSchedule(ctx, db, weekly)
+				return err
+			},
+			wantLoaded:  []string{weekly.ID},
+			wantVersion: 2,
+			wantNewID:   true,
+		},
+		{
+			name: "ativado passa a ser carregado",
+			change: func() error {
+				disabled.Enabled = true
+				_, err := database.UpdateSchedule(ctx, db, disabled)
+				return err
+			},
+			wantLoaded:  []string{weekly.ID, disabled.ID},
+			wantVersion: 2,
+		},
+		{
+			name: "cron inválido é descarregado",
+			change: func() error {
+				_, err := db.Exec(`UPDATE export_schedules SET cron = 'nunca', version = version + 1 WHERE id = ?`, disabled.ID)
+				return err
+			},
+			wantLoaded:  []string{weekly.ID},
+			wantVersion: 2,
+		},
+		{
+			name: "removido é descarregado",
+			change: func() error {
+				_, err := database.DeleteSchedule(ctx, db, weekly.ID)
+				return err
+			},
+		},
+	}
+
+	var lastEntry scheduleEntry
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.change(); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.ReloadSchedules(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := s.loadedSchedules(); got != len(tt.wantLoaded) {
+				t.Errorf("%d agendamentos carregados, esperado %d", got, len(tt.wantLoaded))
+			}
+			if got := len(s.cron.Entries()); got != len(tt.wantLoaded) {
+				t.Errorf("%d entradas no cron, esperado %d", got, len(tt.wantLoaded))
+			}
+			for _, id := range tt.wantLoaded {
+				if _, ok := entryOf(id); !ok {
+					t.Errorf("agendamento %s não carregado", id)
+				}
+			}
+
+			entry, ok := entryOf(weekly.ID)
+			if !ok {
+				return
+			}
+			if entry.version != tt.wantVersion {
+				t.Errorf("versão carregada = %d, esperado %d", entry.version, tt.wantVersion)
+			}
+			if (entry.entryID != lastEntry.entryID) != tt.wantNewID {
+				t.Errorf("entrada do cron %d -> %d, esperado nova entrada = %v", lastEntry.entryID, entry.entryID, tt.wantNewID)
+			}
+			lastEntry = entry
+		})
+	}
+}
+
+func TestSchedulerPollsSchedules(t *testing.T) {
+	ctx := context.Background()
+	db := openQuotaDB(t)
+	s := NewScheduler(&config.Config{
+		EnableScheduler:        true,
+		MonthlyCron:            "0 6 1 * *",
+		ScheduleReloadInterval: 20 * time.Millisecond,
+	}, db)
+
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	// Agendamento criado por outra réplica depois do Start
+	sched := &models.ExportSchedule{
+		Name:         "Semanal",
+		Cron:         "0 8 * * 1",
+		TargetType:   models.ScheduleTargetConsenting,
+		Period:       models.PeriodLastWeek,
+		DeliveryMode: models.DeliveryModeRecipient,
+		Enabled:      true,
+	}
+	if err := database.CreateSchedule(ctx, db, sched); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for s.loadedSchedules() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("agendamento não carregado pelo reload periódico")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
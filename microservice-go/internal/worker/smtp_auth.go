@@ -0,0 +1,93 @@
+package worker
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/smtp"
+	"os"
+	"strings"
+)
+
+// Modos de TLS do SMTP (SMTP_TLS_MODE)
+const (
+	SMTPTLSStartTLS = "starttls" // Conexão simples promovida com STARTTLS (porta 587)
+	SMTPTLSImplicit = "implicit" // TLS desde o primeiro byte (porta 465)
+	SMTPTLSNone     = "none"     // Sem TLS, para relays locais como MailHog/Mailpit
+)
+
+// Mecanismos de autenticação SMTP (SMTP_AUTH_MECHANISM)
+const (
+	SMTPAuthPlain   = "plain"
+	SMTPAuthLogin   = "login"
+	SMTPAuthCRAMMD5 = "cram-md5"
+	SMTPAuthNone    = "none"
+)
+
+// smtpAuth retorna o smtp.Auth do mecanismo configurado; nil quando não há autenticação
+func (s *SMTPClient) smtpAuth() (smtp.Auth, error) {
+	switch s.AuthMechanism {
+	case SMTPAuthNone:
+		return nil, nil
+	case "", SMTPAuthPlain:
+		return smtp.PlainAuth("", s.Username, s.Password, s.Host), nil
+	case SMTPAuthLogin:
+		return &loginAuth{username: s.Username, password: s.Password, host: s.Host}, nil
+	case SMTPAuthCRAMMD5:
+		return smtp.CRAMMD5Auth(s.Username, s.Password), nil
+	default:
+		return nil, fmt.Errorf("mecanismo de autenticação SMTP desconhecido: %s", s.AuthMechanism)
+	}
+}
+
+// loginAuth implementa AUTH LOGIN, que net/smtp não oferece
+type loginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	// Como PlainAuth, só envia credenciais em conexão cifrada ou local
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	prompt := strings.ToLower(strings.TrimSpace(string(fromServer)))
+	switch {
+	case strings.HasPrefix(prompt, "username"):
+		return []byte(a.username), nil
+	case strings.HasPrefix(prompt, "password"):
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("desafio AUTH LOGIN inesperado: %s", fromServer)
+	}
+}
+
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
+
+// LoadCAFile lê um bundle PEM de CAs para validar o certificado do servidor SMTP
+func LoadCAFile(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler SMTP_CA_FILE: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("SMTP_CA_FILE %s não contém certificados PEM", path)
+	}
+	return pool, nil
+}
@@ -0,0 +1,290 @@
+package worker
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrRecipientRejected indica que o servidor recusou o destinatário de forma
+// definitiva (RCPT TO com 5xx no SMTP, 4xx sobre o campo "to" na API HTTP);
+// repetir o envio não adianta
+var ErrRecipientRejected = errors.New("destinatário recusado")
+
+// MailSession é um Mailer aberto durante um job; Close libera a conexão
+type MailSession interface {
+	Mailer
+	Close() error
+}
+
+// sessionOpener é implementado por backends que reaproveitam conexão entre envios
+type sessionOpener interface {
+	OpenSession() MailSession
+}
+
+// OpenSession abre uma sessão de envio para o job. Backends sem conexão
+// persistente (outbox, http) são apenas embrulhados.
+func OpenSession(mailer Mailer) MailSession {
+	if opener, ok := mailer.(sessionOpener); ok {
+		return opener.OpenSession()
+	}
+	return nopSession{mailer}
+}
+
+// nopSession adapta um Mailer sem conexão persistente
+type nopSession struct {
+	Mailer
+}
+
+func (nopSession) Close() error { return nil }
+
+// SMTPSession mantém uma conexão SMTP autenticada entre os emails de um job.
+// A conexão é aberta no primeiro envio, reiniciada com RSET entre mensagens
+// e refeita quando o servidor a derruba.
+type SMTPSession struct {
+	smtp *SMTPClient
+
+	mu     sync.Mutex
+	conn   net.Conn
+	client *smtp.Client
+}
+
+// OpenSession cria uma sessão; a conexão só é aberta no primeiro envio
+func (s *SMTPClient) OpenSession() MailSession {
+	return &SMTPSession{smtp: s}
+}
+
+// SendEmail envia um email pela conexão da sessão
+func (ss *SMTPSession) SendEmail(ctx context.Context, req EmailRequest) (messageID string, err error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	messageID, msg, err := buildMessage(ss.smtp.FromEmail, ss.smtp.FromName, req)
+	if err != nil {
+		return "", fmt.Errorf("erro ao montar mensagem: %w", err)
+	}
+
+	// Conexão reaproveitada: RSET confirma que continua viva e limpa o estado anterior
+	reused := ss.client != nil
+	if reused {
+		if err := ss.withContext(ctx, ss.client.Reset); err != nil {
+			log.Printf("SMTP session lost (%v), reconnecting", err)
+			ss.closeConn()
+			reused = false
+		}
+	}
+
+	if !reused {
+		if err := ss.connect(ctx); err != nil {
+			return "", err
+		}
+	}
+
+	var dataSent bool
+	err = ss.withContext(ctx, func() error {
+		dataSent, err = ss.send(req.To, msg)
+		return err
+	})
+	if err != nil && reused && !dataSent && ctx.Err() == nil && isConnectionError(err) {
+		// O servidor pode fechar uma conexão ociosa entre o RSET e o envio.
+		// Só reenvia se a mensagem não chegou ao fim do DATA, evitando duplicatas.
+		log.Printf("SMTP session dropped (%v), reconnecting", err)
+		ss.closeConn()
+		if err := ss.connect(ctx); err != nil {
+			return "", err
+		}
+		err = ss.withContext(ctx, func() error {
+			_, err := ss.send(req.To, msg)
+			return err
+		})
+	}
+	if err != nil {
+		// Recusa do servidor mantém a conexão (o próximo RSET limpa o estado);
+		// falha de transporte a descarta
+		if ctx.Err() != nil || isConnectionError(err) {
+			ss.closeConn()
+		}
+		return "", err
+	}
+
+	return messageID, nil
+}
+
+// Close encerra a conversa com QUIT e fecha a conexão
+func (ss *SMTPSession) Close() error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if ss.client == nil {
+		return nil
+	}
+
+	ss.conn.SetDeadline(time.Now().Add(10 * time.Second))
+	err := ss.client.Quit()
+	ss.closeConn()
+	return err
+}
+
+// connect abre a conexão e autentica
+func (ss *SMTPSession) connect(ctx context.Context) error {
+	conn, client, err := ss.smtp.dial(ctx)
+	if err != nil {
+		return err
+	}
+	ss.conn = conn
+	ss.client = client
+	return nil
+}
+
+// closeConn descarta a conexão atual sem QUIT
+func (ss *SMTPSession) closeConn() {
+	if ss.client != nil {
+		ss.client.Close()
+	}
+	ss.conn = nil
+	ss.client = nil
+}
+
+// withContext executa fn respeitando o prazo e o cancelamento do contexto
+func (ss *SMTPSession) withContext(ctx context.Context, fn func() error) error {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Time{}
+	}
+	ss.conn.SetDeadline(deadline)
+	defer ss.conn.SetDeadline(time.Time{})
+
+	conn := ss.conn
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	err := fn()
+	if ctxErr := ctx.Err(); err != nil && ctxErr != nil {
+		return fmt.Errorf("envio interrompido: %w", ctxErr)
+	}
+	return err
+}
+
+// send transmite uma mensagem na conexão aberta. dataSent indica que a
+// mensagem foi escrita por completo e o servidor pode tê-la aceitado.
+func (ss *SMTPSession) send(to string, msg []byte) (dataSent bool, err error) {
+	// Configurar remetente
+	if err := ss.client.Mail(ss.smtp.FromEmail); err != nil {
+		return false, fmt.Errorf("erro ao definir remetente: %w", err)
+	}
+
+	// Configurar destinatário
+	if err := ss.client.Rcpt(to); err != nil {
+		var protoErr *textproto.Error
+		if errors.As(err, &protoErr) && protoErr.Code >= 500 {
+			return false, fmt.Errorf("%w: %w", ErrRecipientRejected, err)
+		}
+		return false, fmt.Errorf("erro ao definir destinatário: %w", err)
+	}
+
+	// Enviar corpo do email
+	writer, err := ss.client.Data()
+	if err != nil {
+		return false, fmt.Errorf("erro ao preparar envio: %w", err)
+	}
+
+	if _, err := writer.Write(msg); err != nil {
+		return false, fmt.Errorf("erro ao escrever mensagem: %w", err)
+	}
+
+	if err := writer.Close(); err != nil {
+		return true, fmt.Errorf("erro ao fechar writer: %w", err)
+	}
+
+	return true, nil
+}
+
+// dial conecta ao servidor, negocia TLS conforme TLSMode e autentica
+func (s *SMTPClient) dial(ctx context.Context) (net.Conn, *smtp.Client, error) {
+	addr := net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+
+	tlsConfig := &tls.Config{
+		ServerName: s.Host,
+		RootCAs:    s.RootCAs,
+	}
+
+	var conn net.Conn
+	var err error
+	if s.TLSMode == SMTPTLSImplicit {
+		// TLS desde a conexão (porta 465)
+		dialer := tls.Dialer{Config: tlsConfig}
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	} else {
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("erro ao conectar: %w", err)
+	}
+
+	// Handshake limitado pelo prazo do job
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	client, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("erro ao criar cliente SMTP: %w", err)
+	}
+
+	// STARTTLS é o padrão (porta 587); "none" segue sem TLS para relays locais
+	if s.TLSMode == "" || s.TLSMode == SMTPTLSStartTLS {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, nil, fmt.Errorf("erro ao iniciar TLS: %w", err)
+		}
+	}
+
+	// Autenticação
+	auth, err := s.smtpAuth()
+	if err != nil {
+		client.Close()
+		return nil, nil, err
+	}
+	if auth != nil {
+		if err := client.Auth(auth); err != nil {
+			client.Close()
+			return nil, nil, fmt.Errorf("erro na autenticação SMTP: %w", err)
+		}
+	}
+
+	conn.SetDeadline(time.Time{})
+	return conn, client, nil
+}
+
+// isRecipientRejected informa se o envio falhou por recusa definitiva do destinatário
+func isRecipientRejected(err error) bool {
+	return errors.Is(err, ErrRecipientRejected)
+}
+
+// isConnectionError indica falha de transporte ou 421 (serviço encerrando a conexão)
+func isConnectionError(err error) bool {
+	var netErr net.Error
+	var protoErr *textproto.Error
+	switch {
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, net.ErrClosed):
+		return true
+	case errors.As(err, &netErr):
+		return true
+	case errors.As(err, &protoErr):
+		return protoErr.Code == 421
+	}
+	return false
+}
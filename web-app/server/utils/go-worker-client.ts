@@ -13,23 +13,31 @@ const GO_WORKER_API_KEY = process.env.GO_WORKER_API_KEY || ''
 export interface GoWorkerJobPayload {
   user_ids?: string[]
   turma_name?: string
+  turma_ids?: string[]
+  turma_names?: string[]
+  all_consenting?: boolean
   start_date: string // ISO 8601
   end_date: string   // ISO 8601
   to_email: string
   batch_size?: number
   export_record_id?: string
   subject?: string
+  delivery_mode?: 'BATCH' | 'RECIPIENT'
+  idempotency_key?: string
 }
 
 export interface EnqueueJobOptions {
   type: 'MANUAL' | 'MONTHLY_AUTO'
   priority?: number
+  max_retries?: number
+  run_at?: string // ISO 8601; adia a execução do job
   payload: GoWorkerJobPayload
 }
 
 export interface EnqueueJobResponse {
   job_id: string
   status: string
+  duplicate?: boolean
 }
 
 /**
@@ -105,6 +113,44 @@ export async function getJobQueue(status?: string) {
   return response.json()
 }
 
+export interface ListJobsOptions {
+  status?: string[]
+  type?: 'MANUAL' | 'MONTHLY_AUTO'
+  created_from?: string // ISO 8601
+  created_to?: string   // ISO 8601
+  user_id?: string
+  sort?: 'created_at' | 'priority'
+  order?: 'asc' | 'desc'
+  limit?: number
+  cursor?: string
+}
+
+/**
+ * Lista jobs do Go Worker com filtros e paginação por cursor
+ *
+ * @param options Filtros, ordenação e cursor da página
+ * @returns Jobs da página e next_cursor (null na última página)
+ */
+export async function listGoWorkerJobs(options: ListJobsOptions = {}) {
+  const url = new URL(`${GO_WORKER_URL}/api/v1/jobs`)
+  for (const [key, value] of Object.entries(options)) {
+    if (value === undefined || value === '') continue
+    url.searchParams.set(key, Array.isArray(value) ? value.join(',') : String(value))
+  }
+
+  const response = await fetch(url.toString(), {
+    headers: {
+      'X-API-Key': GO_WORKER_API_KEY
+    }
+  })
+
+  if (!response.ok) {
+    throw new Error(`Go worker error: ${response.status}`)
+  }
+
+  return response.json()
+}
+
 /**
  * Verifica saúde do Go Worker
  *